@@ -0,0 +1,75 @@
+package convert
+
+import (
+	"fmt"
+	"math"
+)
+
+// AltitudeMode ... how the Z of inbound coordinates is read, as KML's altitudeMode
+type AltitudeMode string
+
+const (
+	// Absolute takes Z as an elevation, filling it from the DEM only where it's missing (the default)
+	Absolute AltitudeMode = "absolute"
+
+	// RelativeToGround takes Z as a height above the DEM, eg power lines or drone waypoints
+	RelativeToGround AltitudeMode = "relativeToGround"
+
+	// ClampToGround ignores Z, placing every coordinate on the DEM
+	ClampToGround AltitudeMode = "clampToGround"
+)
+
+// valid reports an error for an unknown altitude mode
+func (mode AltitudeMode) valid() error {
+	switch mode {
+	case "", Absolute, RelativeToGround, ClampToGround:
+		return nil
+	}
+	return fmt.Errorf("unknown altitude mode %q, use absolute, relativeToGround or clampToGround", mode)
+}
+
+// needsGround reports whether a coordinate's z, NaN if it has none, is read from the DEM
+func (o *Options) needsGround(z float64) bool {
+	return math.IsNaN(z) || (o.AltitudeMode != "" && o.AltitudeMode != Absolute)
+}
+
+// altitude resolves a coordinate's z, NaN if it has none, over the ground, NaN where the DEM has none.
+// The DEM is orthometric, so an ellipsoidal z is taken down by the geoid undulation first, and an
+// ellipsoidal output taken back up.
+func (o *Options) altitude(z float64, ground float64, undulation float64) float64 {
+	if math.IsNaN(ground) {
+		ground = 0
+	}
+
+	switch o.AltitudeMode {
+	case RelativeToGround:
+		if math.IsNaN(z) {
+			z = 0
+		}
+		z += ground
+	case ClampToGround:
+		z = ground
+	default:
+		if math.IsNaN(z) {
+			z = ground
+		} else if o.ZDatum == Ellipsoidal {
+			z -= undulation
+		}
+	}
+
+	z += o.ZOffset
+	if o.OutputZDatum == Ellipsoidal {
+		z += undulation
+	}
+	return z
+}
+
+// placed returns the options for coordinates already resolved to absolute elevations
+func (o *Options) placed() *Options {
+	p := *o
+	p.AltitudeMode = Absolute
+	p.ZOffset = 0
+	p.ZDatum = o.OutputZDatum
+	p.VerticalUnits = Meters
+	return &p
+}
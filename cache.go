@@ -0,0 +1,210 @@
+package convert
+
+import (
+	"container/list"
+	"math"
+	"sync"
+)
+
+// the world DEM tiles kept by default, each holds the cells looked up within one degree
+const defaultCacheTiles = 64
+
+// CachedProvider ... remembers the elevations of a provider by DEM tile (one degree of lon lat),
+// keeping the most recently used MaxTiles tiles.  Lookups are snapped to the nearest multiple
+// of CellSize degrees, matching the pixel is point arc second cells of srtm.
+type CachedProvider struct {
+	Provider ElevationProvider
+	MaxTiles int
+	CellSize float64
+
+	mu     sync.Mutex
+	tiles  map[tileKey]*list.Element
+	lru    *list.List
+	hits   int
+	misses int
+}
+
+// tileKey ... the south west corner of a one degree tile
+type tileKey struct {
+	lon int
+	lat int
+}
+
+// cachedTile ... the cells of a tile looked up so far, NaN where the provider had none
+type cachedTile struct {
+	key   tileKey
+	cells map[int]float64
+}
+
+// cellKey ... a snapped lookup
+type cellKey struct {
+	tile tileKey
+	cell int
+}
+
+// NewCachedProvider caches provider, keeping maxTiles tiles, at the provider's cell size or an arc second
+func NewCachedProvider(provider ElevationProvider, maxTiles int) *CachedProvider {
+	cellSize := arcSecond
+	if p, ok := provider.(gridSpacing); ok {
+		cellSize = p.spacing()
+	}
+
+	return &CachedProvider{Provider: provider, MaxTiles: maxTiles, CellSize: cellSize}
+}
+
+// snap returns the cell holding a lon lat, and the lon lat of its center
+func (c *CachedProvider) snap(lon float64, lat float64) (cellKey, float64, float64) {
+	key := tileKey{lon: int(math.Floor(lon)), lat: int(math.Floor(lat))}
+
+	perDegree := int(math.Round(1 / c.CellSize))
+	col := int(math.Round((lon - float64(key.lon)) / c.CellSize))
+	row := int(math.Round((lat - float64(key.lat)) / c.CellSize))
+
+	return cellKey{tile: key, cell: row*(perDegree+1) + col}, float64(key.lon) + float64(col)*c.CellSize, float64(key.lat) + float64(row)*c.CellSize
+}
+
+// lookup returns a cached cell, marking its tile as recently used.  Must hold the lock.
+func (c *CachedProvider) lookup(key cellKey) (float64, bool) {
+	if c.tiles == nil {
+		return 0, false
+	}
+
+	element, ok := c.tiles[key.tile]
+	if !ok {
+		return 0, false
+	}
+	c.lru.MoveToFront(element)
+
+	z, ok := element.Value.(*cachedTile).cells[key.cell]
+	return z, ok
+}
+
+// store caches a cell, evicting the least recently used tile when full.  Must hold the lock.
+func (c *CachedProvider) store(key cellKey, z float64) {
+	if c.tiles == nil {
+		c.tiles = make(map[tileKey]*list.Element)
+		c.lru = list.New()
+	}
+
+	element, ok := c.tiles[key.tile]
+	if !ok {
+		element = c.lru.PushFront(&cachedTile{key: key.tile, cells: make(map[int]float64)})
+		c.tiles[key.tile] = element
+
+		for c.MaxTiles > 0 && c.lru.Len() > c.MaxTiles {
+			oldest := c.lru.Back()
+			c.lru.Remove(oldest)
+			delete(c.tiles, oldest.Value.(*cachedTile).key)
+		}
+	}
+
+	element.Value.(*cachedTile).cells[key.cell] = z
+}
+
+// ElevationAt ... see ElevationProvider
+func (c *CachedProvider) ElevationAt(lon float64, lat float64) (float64, error) {
+	key, clon, clat := c.snap(lon, lat)
+
+	c.mu.Lock()
+	z, ok := c.lookup(key)
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		var err error
+		z, err = c.Provider.ElevationAt(clon, clat)
+		if err != nil {
+			z = math.NaN()
+		}
+
+		c.mu.Lock()
+		c.store(key, z)
+		c.mu.Unlock()
+	}
+
+	if math.IsNaN(z) {
+		return 0, errNoElevation
+	}
+	return z, nil
+}
+
+// ElevationsAt ... see ElevationProvider, the cells missing from the cache go to the provider in one batch
+func (c *CachedProvider) ElevationsAt(lonlats [][]float64) ([]float64, error) {
+	zs := make([]float64, len(lonlats))
+	keys := make([]cellKey, len(lonlats))
+
+	var missing [][]float64
+	var missingKeys []cellKey
+	queued := make(map[cellKey]bool)
+
+	c.mu.Lock()
+	for i, lonlat := range lonlats {
+		key, clon, clat := c.snap(lonlat[0], lonlat[1])
+		keys[i] = key
+
+		z, ok := c.lookup(key)
+		if ok {
+			c.hits++
+			zs[i] = z
+			continue
+		}
+
+		c.misses++
+		zs[i] = math.NaN()
+		if !queued[key] {
+			queued[key] = true
+			missing = append(missing, []float64{clon, clat})
+			missingKeys = append(missingKeys, key)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(missing) == 0 {
+		return zs, nil
+	}
+
+	found, err := c.Provider.ElevationsAt(missing)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	fetched := make(map[cellKey]float64)
+	for i, key := range missingKeys {
+		c.store(key, found[i])
+		fetched[key] = found[i]
+	}
+	c.mu.Unlock()
+
+	for i, key := range keys {
+		if z, ok := fetched[key]; ok {
+			zs[i] = z
+		}
+	}
+
+	return zs, nil
+}
+
+// ElevationFromPolygon ... see PolygonElevationProvider, the provider's own drape if it has one
+func (c *CachedProvider) ElevationFromPolygon(polygon [][][]float64) ([][]float64, error) {
+	if p, ok := c.Provider.(PolygonElevationProvider); ok {
+		return p.ElevationFromPolygon(polygon)
+	}
+	return polygonCloud(c, polygon)
+}
+
+// spacing is the cell size of the cache
+func (c *CachedProvider) spacing() float64 {
+	return c.CellSize
+}
+
+// Stats returns the cache hits and misses so far
+func (c *CachedProvider) Stats() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
@@ -0,0 +1,152 @@
+package convert
+
+import (
+	"math"
+	"strconv"
+)
+
+// Composite ... regularizes a hole's intervals, to a fixed length, by the boundaries of an
+// attribute (eg lithology), or to a fixed length within each run of that attribute
+type Composite struct {
+	Length   float64  `json:"length" yaml:"length"`     // in the depth units of the interval table, 0 for a composite per boundary run
+	Boundary string   `json:"boundary" yaml:"boundary"` // attribute whose changes end a composite
+	Exclude  []string `json:"exclude" yaml:"exclude"`   // attributes left out of the composites, eg sample ids
+}
+
+// Composite regularizes the hole's intervals.  Numeric attributes are weighted by the length
+// of each sample within the composite, and text attributes take the category with the most length.
+// A short composite left at the bottom of a run is merged into the one above it.
+// The intervals are expected sorted and free of overlaps, see Validate.
+func (hole *Drillhole) Composite(c Composite) []Interval {
+	exclude := make(map[string]bool)
+	for _, key := range c.Exclude {
+		exclude[key] = true
+	}
+
+	// runs of intervals sharing the boundary attribute, the whole hole without one
+	var runs [][]Interval
+	for i, interval := range hole.Intervals {
+		if i == 0 || (c.Boundary != "" && attributeValue(interval.Attributes, c.Boundary) != attributeValue(hole.Intervals[i-1].Attributes, c.Boundary)) {
+			runs = append(runs, nil)
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], interval)
+	}
+
+	var composites []Interval
+	for _, run := range runs {
+		top, bottom := run[0].From, run[len(run)-1].To
+
+		// the composite windows within the run
+		windows := [][2]float64{{top, bottom}}
+		if c.Length > 0 {
+			windows = nil
+			for i := 0; top+float64(i)*c.Length < bottom-1e-6; i++ {
+				from := round6(top + float64(i)*c.Length)
+				windows = append(windows, [2]float64{from, math.Min(round6(from+c.Length), bottom)})
+			}
+
+			last := len(windows) - 1
+			if last > 0 && windows[last][1]-windows[last][0] < c.Length/2 {
+				windows[last-1][1] = windows[last][1]
+				windows = windows[:last]
+			}
+		}
+
+		for _, window := range windows {
+			if composite, ok := compositeWindow(run, window[0], window[1], exclude); ok {
+				composites = append(composites, composite)
+			}
+		}
+	}
+
+	return composites
+}
+
+// compositeWindow length weights the intervals within from and to, false if none were sampled
+func compositeWindow(intervals []Interval, from float64, to float64, exclude map[string]bool) (Interval, bool) {
+	var keys []string
+	sampled := make(map[string]float64)
+	sums := make(map[string]float64)
+	numeric := make(map[string]bool)
+	categories := make(map[string]map[string]float64)
+	order := make(map[string][]string)
+
+	var length float64
+	for _, interval := range intervals {
+		weight := math.Min(interval.To, to) - math.Max(interval.From, from)
+		if weight <= 0 {
+			continue
+		}
+		length += weight
+
+		for _, attribute := range interval.Attributes {
+			if exclude[attribute.Key] {
+				continue
+			}
+
+			if _, seen := categories[attribute.Key]; !seen {
+				keys = append(keys, attribute.Key)
+				categories[attribute.Key] = make(map[string]float64)
+				numeric[attribute.Key] = true
+			}
+
+			if _, seen := categories[attribute.Key][attribute.Value]; !seen {
+				order[attribute.Key] = append(order[attribute.Key], attribute.Value)
+			}
+			categories[attribute.Key][attribute.Value] += weight
+
+			value, err := strconv.ParseFloat(attribute.Value, 64)
+			if err != nil {
+				numeric[attribute.Key] = false
+				continue
+			}
+			sums[attribute.Key] += value * weight
+			sampled[attribute.Key] += weight
+		}
+	}
+
+	if length == 0 {
+		return Interval{}, false
+	}
+
+	composite := Interval{From: from, To: to}
+	composite.Attributes = []Attribute{
+		{Key: "from", Value: strconv.FormatFloat(from, 'f', -1, 64)},
+		{Key: "to", Value: strconv.FormatFloat(to, 'f', -1, 64)},
+		{Key: "length", Value: strconv.FormatFloat(round6(to-from), 'f', -1, 64)},
+	}
+
+	for _, key := range keys {
+		if numeric[key] {
+			mean := round6(sums[key] / sampled[key])
+			composite.Attributes = append(composite.Attributes, Attribute{Key: key, Value: strconv.FormatFloat(mean, 'f', -1, 64)})
+			continue
+		}
+
+		// the dominant category, the first seen wins a tie
+		var dominant string
+		for _, value := range order[key] {
+			if dominant == "" || categories[key][value] > categories[key][dominant] {
+				dominant = value
+			}
+		}
+		composite.Attributes = append(composite.Attributes, Attribute{Key: key, Value: dominant})
+	}
+
+	return composite, true
+}
+
+// attributeValue returns the value of the attribute with the key, or ""
+func attributeValue(attributes []Attribute, key string) string {
+	for _, attribute := range attributes {
+		if attribute.Key == key {
+			return attribute.Value
+		}
+	}
+	return ""
+}
+
+// round6 rounds to six decimals, enough for any assay
+func round6(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
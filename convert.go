@@ -1,7 +1,6 @@
 package convert
 
 import (
-	"bytes"
 	"encoding/csv"
 	"errors"
 	"fmt"
@@ -15,8 +14,6 @@ import (
 	"sync"
 
 	srtm "github.com/amundsentech/elev-utils"
-	"github.com/amundsentech/gpx-decode"
-	"github.com/amundsentech/kml-decode"
 	"github.com/fogleman/delaunay"
 	"github.com/golang/geo/s2"
 	geo "github.com/paulmach/go.geo"
@@ -36,6 +33,20 @@ type Datasets struct {
 	Points  []Points `json:"points" yaml:"points"`
 	Lines   []Lines  `json:"lines" yaml:"lines"`
 	Shapes  []Shapes `json:"shapes" yaml:"shapes"`
+
+	// Metadata records how the dataset was read, eg the units of its coordinates, and what the
+	// source says of itself, eg a gpx's description and author
+	Metadata []Attribute `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	// Resources are the files a kmz embeds, eg the icons and overlay images of its styles
+	Resources []Resource `json:"resources,omitempty" yaml:"resources,omitempty"`
+}
+
+// Resource ... a file embedded in a dataset, by its path within the dataset
+type Resource struct {
+	Path      string `json:"path" yaml:"path"`
+	MediaType string `json:"mediatype" yaml:"mediatype"`
+	Data      []byte `json:"data" yaml:"data"`
 }
 
 // Individual Point Coordinate ...
@@ -66,6 +77,9 @@ type Lines struct {
 	StyleType  string      `json:"type" yaml:"type"`
 	Attributes []Attribute `json:"attributes" yaml:"attributes"`
 	Points     [][]float64 `json:"points" yaml:"points"`
+
+	// Times are the times of the vertices, eg of a gpx track, "" where a vertex has none
+	Times []string `json:"times,omitempty" yaml:"times,omitempty"`
 }
 
 // Shape ...
@@ -117,6 +131,7 @@ type FeatureInfo struct {
 type ExtentContainer struct {
 	bbox map[string]float64
 	ch   chan []float64
+	opts *Options
 }
 
 const (
@@ -164,14 +179,9 @@ func DemVrtPath() (string, error) {
 	return dvp, nil
 }
 
-// DatasetFromCSV ...
-func DatasetFromCSV(xField string, yField string, zField string, contents io.Reader) (*Datasets, error) {
-
-	// ensure demvrt is set, can't proceed without
-	if _, err := DemVrtPath(); err != nil {
-		return nil, err
-	}
-
+// DatasetFromCSV ... the srs of x and y is Options.SRS, or the SRID of Options.GeometryField.
+// Without either it is an error, unless Options.GuessSRS opts in to the magnitude guess.
+func DatasetFromCSV(xField string, yField string, zField string, contents io.Reader, opts ...Options) (*Datasets, error) {
 	var outdataset Datasets
 
 	raw, err := csv.NewReader(contents).ReadAll()
@@ -183,14 +193,36 @@ func DatasetFromCSV(xField string, yField string, zField string, contents io.Rea
 		return &outdataset, errors.New("no data in dataset")
 	}
 
+	// a geometry column's srid says where the coordinates are
+	if len(opts) > 0 && opts[0].GeometryField != "" {
+		if opts, err = csvGeometryOptions(opts[0].GeometryField, raw, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// ensure demvrt is set, unless an elevation provider is declared
+	options, err := resolveOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	//store the csv headers by index
 	headers := make(map[int]string)
-	container := initExtentContainer()
+	container := initExtentContainer(options)
 
 	for i, record := range raw {
 		switch i {
 		case 0:
 			for i, header := range record {
+				// the geometry column replaces the x y z fields
+				if options.GeometryField != "" {
+					headers[i] = header
+					if header == options.GeometryField {
+						headers[i] = "GEOMETRY"
+					}
+					continue
+				}
+
 				switch header {
 				case xField:
 					headers[i] = "X"
@@ -203,7 +235,14 @@ func DatasetFromCSV(xField string, yField string, zField string, contents io.Rea
 				}
 			}
 		default:
-			ParseCSV(headers, record, &outdataset, container)
+			if options.GeometryField == "" {
+				ParseCSV(headers, record, &outdataset, container)
+				continue
+			}
+
+			if err := parseCSVGeometry(headers, record, &outdataset, container); err != nil {
+				fmt.Printf("NonFatal [parseCSVGeometry] row %d encountered %v\n", i, err.Error())
+			}
 		}
 	}
 
@@ -216,27 +255,26 @@ func DatasetFromCSV(xField string, yField string, zField string, contents io.Rea
 	}
 
 	// configure the center point... in 4326
-	c, err := getCenter(container.bbox)
+	c, err := getCenter(container)
 	if err != nil {
 		return nil, err
 	}
 	outdataset.Center = append(outdataset.Center, c)
 
 	// configure the s2 array... in 4326
-	outdataset.S2 = s2covering(container.bbox)
+	outdataset.S2 = s2covering(container)
+
+	// record how the dataset was read
+	outdataset.Metadata = container.options().metadata()
 
 	return &outdataset, nil
 }
 
-// DatasetFromGEOJSON ...
-func DatasetFromGEOJSON(xField string, yField string, zField string, contents io.Reader) (*Datasets, error) {
+// DatasetFromGEOJSON ... the crs member declares the srs, else Options.SRS, else the coordinates
+// are lon lat in EPSG:4326 as RFC 7946 has it.  Options.GuessSRS opts in to the magnitude guess.
+func DatasetFromGEOJSON(xField string, yField string, zField string, contents io.Reader, opts ...Options) (*Datasets, error) {
 	var outdataset *Datasets
 
-	// ensure demvrt is set, can't proceed without
-	if _, err := DemVrtPath(); err != nil {
-		return nil, err
-	}
-
 	raw, err := ioutil.ReadAll(contents)
 	if err != nil {
 		return outdataset, err
@@ -246,14 +284,36 @@ func DatasetFromGEOJSON(xField string, yField string, zField string, contents io
 		return nil, fmt.Errorf("FATAL: no data in dataset")
 	}
 
-	//carries references to this dataset's ch, wg, and bbox
-	container := initExtentContainer()
-
 	rawjson, err := geojson.UnmarshalFeatureCollection(raw)
 	if err != nil {
 		return outdataset, err
 	}
 
+	// a legacy crs member declares the srs, without one or an SRS the spec's lon lat
+	switch {
+	case len(rawjson.CRS) > 0:
+		crs, err := geojsonCRS(rawjson.CRS)
+		if err != nil {
+			return nil, err
+		}
+		if opts, err = declareCRS(crs, "geojson crs", opts); err != nil {
+			return nil, err
+		}
+	case len(opts) == 0 || (opts[0].SRS == 0 && opts[0].MineGrid == nil):
+		if opts, err = declareLonLat("geojson", opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// ensure demvrt is set, unless an elevation provider is declared
+	options, err := resolveOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	//carries references to this dataset's ch, wg, bbox, and options
+	container := initExtentContainer(options)
+
 	// this kicks off the processing of the data
 	outdataset, err = parseGEOJSONCollection(rawjson, container)
 	if err != nil {
@@ -264,7 +324,7 @@ func DatasetFromGEOJSON(xField string, yField string, zField string, contents io
 	close(container.ch)
 
 	// configure the center point... in 4326
-	c, err := getCenter(container.bbox)
+	c, err := getCenter(container)
 	if err != nil {
 		// No center of dataset, which means the dataset is invalid
 		return nil, fmt.Errorf("[getCenter] in pkg [convert] encountered: %v", err)
@@ -272,124 +332,56 @@ func DatasetFromGEOJSON(xField string, yField string, zField string, contents io
 	outdataset.Center = append(outdataset.Center, c)
 
 	// configure the s2 array... in 4326
-	outdataset.S2 = s2covering(container.bbox)
+	outdataset.S2 = s2covering(container)
+
+	// record how the dataset was read
+	outdataset.Metadata = container.options().metadata()
 
 	return outdataset, nil
 }
 
-// Dataset from KML
-func DatasetFromKML(xField string, yField string, zField string, contents io.Reader) (*Datasets, error) {
+// Dataset from KML, lon lat in EPSG:4326 as the spec has it, with or without Options.
+// Options.GuessSRS opts in to the magnitude guess instead.
+func DatasetFromKML(xField string, yField string, zField string, contents io.Reader, opts ...Options) (*Datasets, error) {
 	var outdataset Datasets
-	var kml kmldecode.KML
 
-	// ensure demvrt is set, can't proceed without
-	if _, err := DemVrtPath(); err != nil {
+	// kml coordinates are always lon lat
+	opts, err := declareLonLat("kml", opts)
+	if err != nil {
 		return nil, err
 	}
 
-	// read the inbound file
-	raw, err := ioutil.ReadAll(contents)
+	// ensure demvrt is set, unless an elevation provider is declared
+	options, err := resolveOptions(opts)
 	if err != nil {
-		return &outdataset, err
+		return nil, err
 	}
 
-	kmlbuf := bytes.NewBuffer(raw)
-
-	// decode the kml into a struct
-	kmldecode.KMLDecode(kmlbuf, &kml)
+	// decode the kml into its tree of documents and folders
+	kml, err := decodeKML(contents)
+	if err != nil {
+		return nil, fmt.Errorf("[DatasetFromKML] in pkg [convert] encountered: %v", err)
+	}
 
 	// start a container to watch the coords, build bbox and center
-	container := initExtentContainer()
-
-	// get dataset name
-	outdataset.Name = kml.Document.Folder.Name
-
-	for _, record := range kml.Document.Folder.Placemarks {
+	container := initExtentContainer(options)
 
-		// parse Attributes
-		var attributes []Attribute
-		for _, att := range record.ExtendedData.SchemaData.SimpleData {
-			var attribute Attribute
-			attribute.Key = att.Key
-			attribute.Value = att.Value
-			attributes = append(attributes, attribute)
-		}
-
-		// is point
-		if record.Point.Coordinates != nil && len(record.Point.Coordinates) >= 0 {
-			parsedgeom, _ := ParseNestedGeom(container, record.Point.Coordinates)
-			if err != nil {
-				fmt.Printf("NonFatal [DatasetFromKML] Point encountered %v", err.Error())
-				continue
-			}
-
-			newfeature := Points{Attributes: attributes, Name: record.Name}
-			newfeature.Points = parsedgeom.([]float64)
-
-			outdataset.Points = append(outdataset.Points, newfeature)
-		}
-
-		// is line
-		if record.MultiGeometry.LineString.Coordinates != nil && len(record.MultiGeometry.LineString.Coordinates) >= 0 {
-			parsedgeom, _ := ParseNestedGeom(container, record.MultiGeometry.LineString.Coordinates)
-			if err != nil {
-				fmt.Printf("NonFatal [DatasetFromGPX] LineString encountered %v", err.Error())
-				continue
-			}
+	// get dataset name, placemarks below it carry their folder paths
+	root := kml.dataset()
+	outdataset.Name = root.Name
 
-			newfeature := Lines{Attributes: attributes, Name: record.Name}
-			newfeature.Points = parsedgeom.([][]float64)
-			outdataset.Lines = append(outdataset.Lines, newfeature)
-		}
+	// shared styles and schemas may be anywhere in the document
+	shared := kml.shared()
 
-		// is polygon
-		if record.MultiGeometry.Polygon.OuterBoundary.LinearRing.Coordinates != nil && len(record.MultiGeometry.Polygon.OuterBoundary.LinearRing.Coordinates) >= 0 {
-			parsedgeom, _ := ParseNestedGeom(container, record.MultiGeometry.Polygon.OuterBoundary.LinearRing.Coordinates)
-			if err != nil {
-				fmt.Printf("NonFatal [DatasetFromKML] Polygon encountered %v", err.Error())
-				continue
-			}
-
-			// Construct the new feature
-			newfeature := Shapes{Attributes: attributes, Name: record.Name}
-
-			// kml shapes are [][]float64, must convert to [][][][]float64
-			var poly [][][]float64
-			poly = append(poly, parsedgeom.([][]float64))
-                        newfeature.Points = append(newfeature.Points, poly)
-
-			// test if elevation exists for area
-			if len(record.MultiGeometry.Polygon.OuterBoundary.LinearRing.Coordinates[0]) < 3 {
-				// get a 3D point cloud of the polygon
-				polycloud, err := srtm.ElevationFromPolygon(demdir, poly)
-				if err != nil {
-					fmt.Printf("Warning: [srtm.ElevationFromPolygon] in pkg [convert] by kml polygon encountered: %v\n", err)
-					goto SkipToEnd
-				}
-
-				// convert polycloud into a triangulation array
-				triangulation, err := DeriveDelaunay(demdir, &polycloud)
-				if err != nil {
-					fmt.Printf("Warning: [DeriveDelaunay] in pkg [convert] by kml polygon encountered: %v\n", err)
-					goto SkipToEnd
-				}
-
-				// user did not specify elevation, so send as MESH
-				newfeature.Vertices = PointcloudTo3857(polycloud)
-				newfeature.Indices = triangulation.Triangles
-				newfeature.Points = nil
-			}
-
-			SkipToEnd:
-				outdataset.Shapes = append(outdataset.Shapes, newfeature)
-		}
-	}
+	root.walk("", func(record *kmlPlacemark, folder string) {
+		parseKMLPlacemark(record, folder, shared, &outdataset, container)
+	})
 
 	// close the BBOXlistener goroutine
 	close(container.ch)
 
 	// configure the center point... in 4326
-	c, err := getCenter(container.bbox)
+	c, err := getCenter(container)
 	if err != nil {
 		// No center of dataset, which means the dataset is invalid
 		return nil, fmt.Errorf("[getCenter] in pkg [convert] encountered: %v", err)
@@ -397,134 +389,61 @@ func DatasetFromKML(xField string, yField string, zField string, contents io.Rea
 	outdataset.Center = append(outdataset.Center, c)
 
 	// configure the s2 array... in 4326
-	outdataset.S2 = s2covering(container.bbox)
+	outdataset.S2 = s2covering(container)
+
+	// record how the dataset was read
+	outdataset.Metadata = container.options().metadata()
 
 	return &outdataset, nil
 }
 
-// Dataset from GPX
-func DatasetFromGPX(xField string, yField string, zField string, contents io.Reader) (*Datasets, error) {
+// Dataset from GPX, lat lon in EPSG:4326 as the spec has it, with or without Options.
+// Options.GuessSRS opts in to the magnitude guess instead.
+func DatasetFromGPX(xField string, yField string, zField string, contents io.Reader, opts ...Options) (*Datasets, error) {
 	var outdataset Datasets
-	var gpx gpxdecode.GPX
 
-	// ensure demvrt is set, can't proceed without
-	if _, err := DemVrtPath(); err != nil {
+	// gpx coordinates are always wgs84
+	opts, err := declareLonLat("gpx", opts)
+	if err != nil {
 		return nil, err
 	}
 
-	// read the inbound file
-	raw, err := ioutil.ReadAll(contents)
+	// ensure demvrt is set, unless an elevation provider is declared
+	options, err := resolveOptions(opts)
 	if err != nil {
-		return &outdataset, err
+		return nil, err
 	}
 
-	gpxbuf := bytes.NewBuffer(raw)
-
-	// decode the kml into a struct
-	gpxdecode.GPXDecode(gpxbuf, &gpx)
+	// decode the gpx into a struct
+	gpx, err := decodeGPX(contents)
+	if err != nil {
+		return nil, fmt.Errorf("[DatasetFromGPX] in pkg [convert] encountered: %v", err)
+	}
 
 	// start a container to watch the coords, build bbox and center
-	container := initExtentContainer()
+	container := initExtentContainer(options)
 
-	// TBD get dataset name
-	// outdataset.Name = gpx.?.Name
+	// get dataset name
+	outdataset.Name = gpx.name()
 
 	// is point
-	if gpx.Waypoint != nil && len(gpx.Waypoint) >= 0 {
-
-		for _, record := range gpx.Waypoint {
-
-			// parse Attributes
-			var attributes []Attribute
-			for _, att := range record.Extensions.OGR {
-				var attribute Attribute
-				attribute.Key = att.Key
-				attribute.Value = att.Value
-				attributes = append(attributes, attribute)
-			}
-
-			// parse Geom
-			point := []float64{record.Lon, record.Lat, record.Ele}
-
-			parsedgeom, _ := ParseNestedGeom(container, point)
-			if err != nil {
-				fmt.Printf("NonFatal [DatasetFromGPX] gpx.Waypoint encountered %v\n", err.Error())
-				continue
-			}
-
-			newfeature := Points{Attributes: attributes, Name: record.Name}
-			newfeature.Points = parsedgeom.([]float64)
-			outdataset.Points = append(outdataset.Points, newfeature)
+	for _, record := range gpx.Waypoints {
+		if err := parseGPXPoint(record, &outdataset, container); err != nil {
+			fmt.Printf("NonFatal [DatasetFromGPX] gpx.Waypoint encountered %v\n", err.Error())
 		}
 	}
 
 	// is route
-	if gpx.Route != nil && len(gpx.Route) >= 0 {
-
-		for _, record := range gpx.Route {
-
-			// parse Attributes
-			var attributes []Attribute
-			for _, att := range record.Extensions.OGR {
-				var attribute Attribute
-				attribute.Key = att.Key
-				attribute.Value = att.Value
-				attributes = append(attributes, attribute)
-			}
-
-			// parse Geom
-			var line [][]float64
-			for _, coord := range record.RoutePoints {
-				point := []float64{coord.Lon, coord.Lat, coord.Ele}
-				line = append(line, point)
-			}
-
-			parsedgeom, _ := ParseNestedGeom(container, line)
-			if err != nil {
-				fmt.Printf("NonFatal [DatasetFromGPX] gpx.Route encountered %v\n", err.Error())
-				continue
-			}
-
-			newfeature := Lines{Attributes: attributes, Name: record.Name}
-			newfeature.Points = parsedgeom.([][]float64)
-			outdataset.Lines = append(outdataset.Lines, newfeature)
-
+	for _, record := range gpx.Routes {
+		if err := parseGPXLine(record.Name, record.Extensions.attributes(), record.Points, &outdataset, container); err != nil {
+			fmt.Printf("NonFatal [DatasetFromGPX] gpx.Route encountered %v\n", err.Error())
 		}
 	}
 
-	// is track
-	if gpx.Track != nil && len(gpx.Track) >= 0 {
-
-		for _, record := range gpx.Track {
-
-			// parse Attributes
-			var attributes []Attribute
-			for _, att := range record.Extensions.OGR {
-				var attribute Attribute
-				attribute.Key = att.Key
-				attribute.Value = att.Value
-				attributes = append(attributes, attribute)
-			}
-
-			// parse Geom
-			var line [][]float64
-			for _, track := range record.TrackSegment {
-				for _, coord := range track.TrackPoint {
-					point := []float64{coord.Lon, coord.Lat, coord.Ele}
-					line = append(line, point)
-				}
-			}
-
-			parsedgeom, _ := ParseNestedGeom(container, line)
-			if err != nil {
-				fmt.Printf("NonFatal [DatasetFromGPX] gpx.Track encountered %v\n", err.Error())
-				continue
-			}
-
-			newfeature := Lines{Attributes: attributes, Name: record.Name}
-			newfeature.Points = parsedgeom.([][]float64)
-			outdataset.Lines = append(outdataset.Lines, newfeature)
-
+	// is track, a line per segment
+	for _, record := range gpx.Tracks {
+		if err := parseGPXTrack(record, &outdataset, container); err != nil {
+			fmt.Printf("NonFatal [DatasetFromGPX] gpx.Track encountered %v\n", err.Error())
 		}
 	}
 
@@ -532,7 +451,7 @@ func DatasetFromGPX(xField string, yField string, zField string, contents io.Rea
 	close(container.ch)
 
 	// configure the center point... in 4326
-	c, err := getCenter(container.bbox)
+	c, err := getCenter(container)
 	if err != nil {
 		// No center of dataset, which means the dataset is invalid
 		return nil, fmt.Errorf("[getCenter] in pkg [convert] encountered: %v", err)
@@ -540,7 +459,10 @@ func DatasetFromGPX(xField string, yField string, zField string, contents io.Rea
 	outdataset.Center = append(outdataset.Center, c)
 
 	// configure the s2 array... in 4326
-	outdataset.S2 = s2covering(container.bbox)
+	outdataset.S2 = s2covering(container)
+
+	// record how the dataset was read, and what the gpx says of itself
+	outdataset.Metadata = append(container.options().metadata(), gpx.metadata()...)
 
 	return &outdataset, nil
 }
@@ -571,7 +493,7 @@ func ParseCSV(headers map[int]string, record []string, outdataset *Datasets, con
 	}
 
 	// enforce 3857 and elevation
-	coord, err := CheckCoords(xyz)
+	coord, err := container.options().checkCoords(xyz)
 	if err != nil {
 		// skip a bunk coordinate
 		fmt.Printf("Non fatal: [ParseCSV] error in [CheckCoords]: %v\n", err.Error())
@@ -590,6 +512,97 @@ func ParseCSV(headers map[int]string, record []string, outdataset *Datasets, con
 	outdataset.Points = append(outdataset.Points, point)
 }
 
+// parseCSVGeometry converts a row with a geometry column, as a geojson feature would be, with
+// the other columns in order as its attributes
+func parseCSVGeometry(headers map[int]string, record []string, outdataset *Datasets, container *ExtentContainer) error {
+	var geometry *geojson.Geometry
+	var srid int
+	var err error
+
+	properties := make(map[string]interface{})
+	var keys []string
+
+	for i, value := range record {
+		if headers[i] == "GEOMETRY" {
+			if geometry, srid, err = DecodeGeometry(value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key := propertyKey(headers[i])
+		properties[key] = value
+		keys = append(keys, key)
+	}
+
+	// an empty geometry is no feature
+	if geometry == nil {
+		return nil
+	}
+
+	if err := checkSRID(srid, container); err != nil {
+		return err
+	}
+
+	return parseFeatureGeometries(splitGeometry(geometry), properties, keys, outdataset, container)
+}
+
+// checkSRID refuses a geometry whose srid conflicts with the dataset's srs.  A mine grid's
+// coordinates are local, whatever their srid.
+func checkSRID(srid int, container *ExtentContainer) error {
+	o := container.options()
+	if srid == 0 || o.MineGrid != nil {
+		return nil
+	}
+
+	declared, err := o.crs()
+	if err != nil || declared == nil {
+		return err
+	}
+
+	crs, err := LookupEPSG(srid)
+	if err != nil {
+		return err
+	}
+	if crs != declared {
+		return fmt.Errorf("geometry srid %d conflicts with the srs %s", srid, declared.Name)
+	}
+	return nil
+}
+
+// csvGeometryOptions declares the first srid of a geometry column in the options, see
+// declareCRS
+func csvGeometryOptions(field string, raw [][]string, opts []Options) ([]Options, error) {
+	column := -1
+	for i, header := range raw[0] {
+		if header == field {
+			column = i
+		}
+	}
+	if column < 0 {
+		return nil, fmt.Errorf("no geometry field %s in the csv", field)
+	}
+
+	for _, record := range raw[1:] {
+		if column >= len(record) {
+			continue
+		}
+
+		_, srid, err := DecodeGeometry(record[column])
+		if err != nil || srid == 0 {
+			continue
+		}
+
+		crs, err := LookupEPSG(srid)
+		if err != nil {
+			return nil, err
+		}
+		return declareCRS(crs, "geometry srid", opts)
+	}
+
+	return opts, nil
+}
+
 //ParseGEOJSONCollection peels into the collection's multiple features
 func parseGEOJSONCollection(collection *geojson.FeatureCollection, container *ExtentContainer) (*Datasets, error) {
 	var outdataset Datasets
@@ -598,6 +611,11 @@ func parseGEOJSONCollection(collection *geojson.FeatureCollection, container *Ex
 		return nil, errors.New("no features to parse")
 	}
 
+	// a legacy crs member says where the coordinates are, it must be honored
+	if err := applyGEOJSONCRS(collection.CRS, container); err != nil {
+		return nil, err
+	}
+
 	var wg sync.WaitGroup
 
 	//access each of the individual features of the geojson
@@ -623,6 +641,64 @@ func parseGEOJSONCollection(collection *geojson.FeatureCollection, container *Ex
 	return &outdataset, nil
 }
 
+// geojsonCRS resolves the legacy geojson "crs" member, of a collection or a geometry
+func geojsonCRS(member map[string]interface{}) (*CRS, error) {
+	properties, _ := member["properties"].(map[string]interface{})
+
+	var crs *CRS
+	var err error
+
+	switch member["type"] {
+	case "name":
+		name, _ := properties["name"].(string)
+		crs, err = LookupCRSName(name)
+	case "EPSG", "epsg":
+		// the 2008 geojson spec form, {"type": "EPSG", "properties": {"code": 26911}}
+		code, _ := properties["code"].(float64)
+		crs, err = LookupEPSG(int(code))
+	default:
+		err = fmt.Errorf("unsupported crs member of type %v", member["type"])
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("geojson crs could not be resolved: %v", err)
+	}
+	return crs, nil
+}
+
+// applyGEOJSONCRS resolves the legacy geojson "crs" member, and declares it as the container's srs
+// an unknown crs, or one that conflicts with the caller's declared srs, is an error
+func applyGEOJSONCRS(member map[string]interface{}, container *ExtentContainer) error {
+	if len(member) == 0 {
+		return nil
+	}
+
+	crs, err := geojsonCRS(member)
+	if err != nil {
+		return err
+	}
+
+	// never modify the shared guess options
+	if container.opts == nil {
+		opts := guessOptions
+		container.opts = &opts
+	}
+
+	declared, err := container.opts.crs()
+	if err != nil {
+		return err
+	}
+
+	if declared != nil && declared != crs {
+		return fmt.Errorf("geojson crs %s conflicts with the declared srs %s", crs.Name, declared.Name)
+	}
+
+	container.opts.SRS = crs.EPSG
+	container.opts.srs = crs
+
+	return nil
+}
+
 //ParseGEOJSONFeature processes geojson feature(s) into a Unity collection (*Dataset)
 func ParseGEOJSONFeature(gfeature *FeatureInfo, outdataset *Datasets, container *ExtentContainer) error {
 
@@ -710,9 +786,9 @@ func ParseGEOJSONFeature(gfeature *FeatureInfo, outdataset *Datasets, container
                 // try to build a drape
                 if len(gfeature.Geojson.Geometry.Polygon[0][0]) < 3 {
 			// get a 3D point cloud of the polygon
-			polycloud, err := srtm.ElevationFromPolygon(demdir, gfeature.Geojson.Geometry.Polygon)
+			polycloud, err := container.options().elevationFromPolygon(nestedGeomTo4326(parsedgeom).([][][]float64))
 			if err != nil {
-				fmt.Printf("Warning: [srtm.ElevationFromPolygon] called in pkg [convert] by polygon encountered :%v\n", err)
+				fmt.Printf("Warning: [elevationFromPolygon] called in pkg [convert] by polygon encountered :%v\n", err)
 				goto FinalizePoly
 			}
 
@@ -750,17 +826,20 @@ func ParseGEOJSONFeature(gfeature *FeatureInfo, outdataset *Datasets, container
                 // try to build a drape
                 if len(gfeature.Geojson.Geometry.MultiPolygon[0][0][0]) < 3 {
 
+			// the drape works in 4326, regardless of the declared srs
+			multipolygon := nestedGeomTo4326(parsedgeom).([][][][]float64)
+
 			// get a 3D point cloud of the polygon
-			polycloud, err := srtm.ElevationFromPolygon(demdir, gfeature.Geojson.Geometry.MultiPolygon[0])
+			polycloud, err := container.options().elevationFromPolygon(multipolygon[0])
 			if err != nil {
-				fmt.Printf("Warning: [srtm.ElevationFromPolygon] called in pkg [convert] by multipolygon encountered :%v\n", err)
+				fmt.Printf("Warning: [elevationFromPolygon] called in pkg [convert] by multipolygon encountered :%v\n", err)
 				goto FinalizeMulti
 			}
 
 			// remove points of the pointcloud that might fall within hole
 			var verifiedpointcloud [][]float64
 			for i, pt := range polycloud {
-				if srtm.IsPointInsideMultiPolygon(gfeature.Geojson.Geometry.MultiPolygon, pt) == true {
+				if srtm.IsPointInsideMultiPolygon(multipolygon, pt) == true {
 					verifiedpointcloud = append(verifiedpointcloud, polycloud[i])
 				}
 			}
@@ -768,13 +847,13 @@ func ParseGEOJSONFeature(gfeature *FeatureInfo, outdataset *Datasets, container
 			// convert newpolycloud into a triangulation array
 			triangulation, err := DeriveDelaunay(demdir, &verifiedpointcloud)
 			if err != nil {
-				fmt.Errorf("Warning [DeriveDelaunay] called in pkg [convert] by multipolygon encountered: %v\n", err)
+				fmt.Printf("Warning [DeriveDelaunay] called in pkg [convert] by multipolygon encountered: %v\n", err)
 				goto FinalizeMulti
 			}
 
 			// delaunay also doesn't recognize holes
 			// parse the triangles to remove those in holes
-			verifiedtriangles := VerifyDelaunay(verifiedpointcloud, triangulation.Triangles, gfeature.Geojson.Geometry.MultiPolygon)
+			verifiedtriangles := VerifyDelaunay(verifiedpointcloud, triangulation.Triangles, multipolygon)
 
 			// use mesh instead of original points
                         newfeature.Vertices = PointcloudTo3857(verifiedpointcloud)
@@ -831,6 +910,36 @@ func ParseGEOJSONAttributes(gfeature *FeatureInfo) []Attribute {
 	return atts
 }
 
+// parseFeatureGeometries parses geometries sharing one set of properties as geojson features,
+// keeping their attributes in the order of headers, eg the columns of a table
+func parseFeatureGeometries(geometries []*geojson.Geometry, properties map[string]interface{}, headers []string, outdataset *Datasets, container *ExtentContainer) error {
+	points, lines, shapes := len(outdataset.Points), len(outdataset.Lines), len(outdataset.Shapes)
+
+	for _, geometry := range geometries {
+		feature := geojson.NewFeature(geometry)
+		for k, v := range properties {
+			feature.Properties[k] = v
+		}
+
+		gfeature := FeatureInfo{Geojson: *feature}
+		if err := ParseGEOJSONFeature(&gfeature, outdataset, container); err != nil {
+			return err
+		}
+	}
+
+	for i := points; i < len(outdataset.Points); i++ {
+		sortAttributes(outdataset.Points[i].Attributes, headers)
+	}
+	for i := lines; i < len(outdataset.Lines); i++ {
+		sortAttributes(outdataset.Lines[i].Attributes, headers)
+	}
+	for i := shapes; i < len(outdataset.Shapes); i++ {
+		sortAttributes(outdataset.Shapes[i].Attributes, headers)
+	}
+
+	return nil
+}
+
 //ParseNestedGeom uses generic recursion to process the nested geometry arrays
 // point	[]float64
 // linestring	[][]float64 *the most common shared pattern
@@ -842,7 +951,7 @@ func ParseNestedGeom(container *ExtentContainer, feature interface{}) (interface
 
 	// one time use case- a point coordinate
 	case []float64:
-		point, err := CheckCoords(v)
+		point, err := container.options().checkCoords(v)
 
 		if err != nil {
 			return nil, err
@@ -858,22 +967,18 @@ func ParseNestedGeom(container *ExtentContainer, feature interface{}) (interface
 	// this is the most common shared pattern, all geometry but point
 	case [][]float64:
 
-		var parsedfeature [][]float64
-
-		for _, j := range v {
+		// the whole line or ring is filled with z in one pass
+		parsedfeature, err := container.options().checkCoordsBatch(v)
 
-			point, err := CheckCoords(j)
-
-			if err != nil {
-				return nil, err
-			}
+		if err != nil {
+			return nil, err
+		}
 
-			// only test bbox if channel is valid
-			if container != nil {
+		// only test bbox if channel is valid
+		if container != nil {
+			for _, point := range parsedfeature {
 				container.ch <- point
 			}
-
-			parsedfeature = append(parsedfeature, point)
 		}
 
 		return parsedfeature, nil
@@ -1061,6 +1166,35 @@ func TrimDEMEdges(pointcloud [][]float64, triangles []int) []int {
 	return verifiedtriangles
 }
 
+// nestedGeomTo4326 unprojects a parsed (EPSG:3857) nested geometry to lon lat,
+// as needed by the polygon drape, without touching the parsed geometry itself
+func nestedGeomTo4326(feature interface{}) interface{} {
+	switch v := feature.(type) {
+	case []float64:
+		lon, lat := webMercatorTo4326(v[0], v[1])
+		return append([]float64{lon, lat}, v[2:]...)
+	case [][]float64:
+		var unprojected [][]float64
+		for _, coord := range v {
+			unprojected = append(unprojected, nestedGeomTo4326(coord).([]float64))
+		}
+		return unprojected
+	case [][][]float64:
+		var unprojected [][][]float64
+		for _, element := range v {
+			unprojected = append(unprojected, nestedGeomTo4326(element).([][]float64))
+		}
+		return unprojected
+	case [][][][]float64:
+		var unprojected [][][][]float64
+		for _, element := range v {
+			unprojected = append(unprojected, nestedGeomTo4326(element).([][][]float64))
+		}
+		return unprojected
+	}
+	return nil
+}
+
 func PointcloudTo3857(pointcloud [][]float64) [][]float64 {
 	for i, point := range pointcloud {
 		x, y := To3857(point[0], point[1])
@@ -1076,9 +1210,12 @@ func PointcloudTo3857(pointcloud [][]float64) [][]float64 {
 // and the s2 key(s) associated with the feature
 
 // initExtentContainer sets up all the elements of the empty struct for each feature
-func initExtentContainer() *ExtentContainer {
+func initExtentContainer(opts *Options) *ExtentContainer {
 	var container ExtentContainer
 
+	// the per dataset options, eg the declared srs
+	container.opts = opts
+
 	// the bbox extent that will observe and grow with coordinates
 	container.bbox = make(map[string]float64)
 
@@ -1134,22 +1271,24 @@ func BBOXListener(container *ExtentContainer) {
 }
 
 // getCenter calculates the center from the bbox extent
-func getCenter(bbox map[string]float64) (Point, error) {
+func getCenter(container *ExtentContainer) (Point, error) {
 	var err error
 	var c Point
+	bbox := container.bbox
 	c.X = bbox["rx"] - (bbox["rx"]-bbox["lx"])/2
 	c.Y = bbox["uy"] - (bbox["uy"]-bbox["ly"])/2
 
-	//get the center of the bbox
-	c.Z, _ = GetElev(c.X, c.Y)
+	//get the center of the bbox, which is always 3857 by now
+	c.Z, _ = container.options().elevationAt(webMercatorTo4326(c.X, c.Y))
 	// ok to return empty center
 
 	return c, err
 }
 
 // s2covering finds the s2 hash key that represents the geographic coverage of the bbox extent
-func s2covering(bbox map[string]float64) []string {
+func s2covering(container *ExtentContainer) []string {
 	var s2hash []string
+	bbox := container.bbox
 
 	// don't panic if bbox is empty... it means we had a bunk dataset
 	if len(bbox) < 4 {
@@ -1157,11 +1296,12 @@ func s2covering(bbox map[string]float64) []string {
 		return s2hash
 	}
 
-	rx, uy := To4326(bbox["rx"], bbox["uy"])
-	lx, ly := To4326(bbox["lx"], bbox["ly"])
+	// the bbox is always 3857 by now, no need to guess
+	rx, uy := webMercatorTo4326(bbox["rx"], bbox["uy"])
+	lx, ly := webMercatorTo4326(bbox["lx"], bbox["ly"])
 
 	// gets final elevation for center calculated point
-	cz, err := GetElev(bbox["rx"], bbox["uy"])
+	cz, err := container.options().elevationAt(rx, uy)
 	if err != nil {
 		// ok to return empty s2hash
 		return s2hash
@@ -1197,60 +1337,140 @@ func s2covering(bbox map[string]float64) []string {
 // 3) and convert a point  EPSG:4326<-->EPSG:3857,
 
 // CheckCoords ... enforces 3857 for X and Y, and fills Z if absent
+// the srs is guessed from coordinate magnitude, see Options for declaring it
 func CheckCoords(coord []float64) ([]float64, error) {
+	return guessOptions.checkCoords(coord)
+}
 
-	// coords are []{x, y, z}
-	switch len(coord) {
-	case 0, 1:
-		// coordinate is bunk
-		return coord, errors.New("missing x, y")
+// checkCoords ... enforces 3857 for X and Y from the declared srs, and resolves Z by the altitude mode
+func (o *Options) checkCoords(coord []float64) ([]float64, error) {
+	parsed, err := o.checkCoordsBatch([][]float64{coord})
+	if err != nil {
+		return coord, err
+	}
+	return parsed[0], nil
+}
 
-	case 2:
-		// enforce 3857
-		x, y := To3857(coord[0], coord[1])
+// checkCoordsBatch ... checkCoords for a whole line or ring, looking up the ground in one batch
+func (o *Options) checkCoordsBatch(coords [][]float64) ([][]float64, error) {
+	if len(coords) == 0 {
+		return nil, nil
+	}
 
-		// use z only if have it else set to 0
-		z, err := GetElev(coord[0], coord[1])
-		if err != nil {
-			z = 0
+	// x y in 3857, and z as given, NaN if absent
+	parsed := make([][]float64, len(coords))
+	withZ := 0
+
+	for i, coord := range coords {
+		// coords are []{x, y, z}
+		switch len(coord) {
+		case 0, 1:
+			// coordinate is bunk
+			return nil, errors.New("missing x, y")
+		case 2, 3:
+		default:
+			// who the hell knows but play it safe
+			return nil, errors.New("too many vectors for point")
 		}
-		return []float64{x, y, z}, nil
 
-	case 3:
 		// enforce 3857
-		x, y := To3857(coord[0], coord[1])
+		x, y, err := o.to3857(coord[0], coord[1])
+		if err != nil {
+			return nil, err
+		}
 
-		// z is already present, use it
-		return []float64{x, y, coord[2]}, nil
+		// z in meters, NaN if absent
+		z := math.NaN()
+		if len(coord) == 3 {
+			z = coord[2] * o.VerticalUnits.toMeter()
+			withZ++
+		}
 
-	default:
-		// who the hell knows but play it safe
-		return coord, errors.New("too many vectors for point")
+		parsed[i] = []float64{x, y, z}
 	}
+
+	// a line is densified so it follows the terrain between its vertices, unless its z is absolute
+	densified := false
+	if o.Drape && (withZ == 0 || o.needsGround(0)) {
+		if provider, err := o.elevation(); err == nil {
+			parsed = densify(parsed, o.drapeSpacing(provider))
+			densified = len(parsed) != len(coords)
+		}
+	}
+
+	// the ground, only where the altitude mode needs it, and the geoid if a height is ellipsoidal
+	geoid := o.needsGeoid()
+	ground := make([]float64, len(parsed))
+	undulation := make([]float64, len(parsed))
+	var lonlats [][]float64
+	var missing []int
+
+	for i, coord := range parsed {
+		ground[i] = math.NaN()
+		if !geoid && !o.needsGround(coord[2]) {
+			continue
+		}
+
+		// unprojected from the source where possible, rather than back from 3857
+		lon, lat := webMercatorTo4326(coord[0], coord[1])
+		if !densified {
+			var err error
+			if lon, lat, err = o.to4326(coords[i][0], coords[i][1]); err != nil {
+				return nil, err
+			}
+		}
+
+		if geoid {
+			var err error
+			if undulation[i], err = o.undulation(lon, lat); err != nil {
+				return nil, err
+			}
+		}
+
+		if o.needsGround(coord[2]) {
+			lonlats = append(lonlats, []float64{lon, lat})
+			missing = append(missing, i)
+		}
+	}
+
+	// use the ground only if have it else leave at 0
+	if len(missing) > 0 {
+		if provider, err := o.elevation(); err == nil {
+			if zs, err := provider.ElevationsAt(lonlats); err == nil {
+				for i, z := range zs {
+					ground[missing[i]] = z
+				}
+			}
+		}
+	}
+
+	for i, coord := range parsed {
+		coord[2] = o.altitude(coord[2], ground[i], undulation[i])
+	}
+
+	return parsed, nil
 }
 
-// GetElev gets the elevation for the given x y coordinate
-func GetElev(x float64, y float64) (float64, error) {
+// GetElev gets the elevation for the given x y coordinate from the world DEM,
+// optionally read with an interpolation other than nearest
+func GetElev(x float64, y float64, mode ...Interpolation) (float64, error) {
 	// outputs in meters, works regardless of input projection
 	lon, lat := To4326(x, y)
 
 	// check Elevation available!!!
-	if _, err := DemVrtPath(); err != nil {
-		return math.NaN(), err
-	}
-
-	// call the elevation service
-	z, err := srtm.ElevationFromLatLon(demdir, lat, lon)
+	provider, err := defaultElevation()
 	if err != nil {
-		return 0.0, fmt.Errorf("[GetElev] in pkg [convert] encountered: %v", err)
+		return math.NaN(), err
 	}
 
-	// raise an error if z not found
-	if math.IsNaN(z) == true {
-		return 0, errors.New("Z value could not be found")
+	if len(mode) > 0 {
+		if err := mode[0].valid(); err != nil {
+			return math.NaN(), err
+		}
+		provider = Interpolated(provider, mode[0])
 	}
 
-	return z, nil
+	return provider.ElevationAt(lon, lat)
 }
 
 // To4326 converts coordinates to EPSG:4326 projection
@@ -1275,8 +1495,10 @@ func To3857(x float64, y float64) (float64, float64) {
 	}
 
 	// trim decimals to the cm
-        xrnd := math.Round(x*100) / 100
-        yrnd := math.Round(y*100) / 100
+	return roundCm(x), roundCm(y)
+}
 
-	return xrnd, yrnd
+// roundCm trims decimals to the cm
+func roundCm(v float64) float64 {
+	return math.Round(v*100) / 100
 }
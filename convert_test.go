@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -44,6 +46,8 @@ const (
         singleshape3D       = "tests/fake/testshape3D.geojson"
         singleshape3D_input = "tests/fake/testshape3D.geojson"
 
+        singleshape3Dcrs = "tests/fake/testshape3D_crs.geojson"
+
         singlemultielev       = "tests/bonanza/bonanza_multiwithelev.geojson"
         singlemultielev_input = "tests/bonanza/bonanza_multiwithelev.json"
 
@@ -91,8 +95,11 @@ func TestCSVData(t *testing.T) {
 			t.Errorf(err.Error())
 		}
 
+		// declare the srs if the input knows it, otherwise guess
+		opts := Options{SRS: input.Srs, GuessSRS: input.Srs == 0}
+
 		// send the information to the tester
-		results, err := DatasetFromCSV(input.Xfield, input.Yfield, input.Zfield, data)
+		results, err := DatasetFromCSV(input.Xfield, input.Yfield, input.Zfield, data, opts)
 		if err != nil {
 			t.Logf("csv conversion error for %s, no features in dataset: %s\n", item, err.Error())
 		}
@@ -149,8 +156,11 @@ func TestGEOJSONData(t *testing.T) {
 			t.Errorf(err.Error())
 		}
 
+		// declare the srs if the input knows it, otherwise guess
+		opts := Options{SRS: input.Srs, GuessSRS: input.Srs == 0}
+
 		// send the information to the tester
-		results, err := DatasetFromGEOJSON(input.Xfield, input.Yfield, input.Zfield, data)
+		results, err := DatasetFromGEOJSON(input.Xfield, input.Yfield, input.Zfield, data, opts)
 
 		if err != nil {
 			t.Errorf("[DatasetFromGEOJSON] in pkg [convert], geojson conversion error for %s: %s\n", item, err.Error())
@@ -180,6 +190,49 @@ func TestGEOJSONData(t *testing.T) {
 	}
 }
 
+func TestGEOJSONCRS(t *testing.T) {
+
+	// the same shape, once in CRS84 and once in UTM 12N declared by a legacy crs member
+	lonlat, err := os.Open(singleshape)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	expected, err := DatasetFromGEOJSON("", "", "", lonlat)
+	if err != nil {
+		t.Errorf("[DatasetFromGEOJSON] in pkg [convert], geojson conversion error for %s: %s\n", singleshape, err.Error())
+		return
+	}
+
+	utm, err := os.Open(singleshape3Dcrs)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	results, err := DatasetFromGEOJSON("", "", "", utm)
+	if err != nil {
+		t.Errorf("[DatasetFromGEOJSON] in pkg [convert], geojson conversion error for %s: %s\n", singleshape3Dcrs, err.Error())
+		return
+	}
+
+	want := expected.Shapes[0].Points[0][0][0]
+	got := results.Shapes[0].Points[0][0][0]
+	if math.Abs(got[0]-want[0]) > 2 || math.Abs(got[1]-want[1]) > 2 {
+		t.Errorf("utm crs member was not honored, first vertex at %v expected %v\n", got, want)
+	}
+
+	// an unknown crs must fail loudly
+	unknown := `{"type": "FeatureCollection", "crs": {"type": "name", "properties": {"name": "urn:ogc:def:crs:EPSG::99999"}},
+		"features": [{"type": "Feature", "properties": {}, "geometry": {"type": "Point", "coordinates": [1, 2, 3]}}]}`
+	if _, err := DatasetFromGEOJSON("", "", "", strings.NewReader(unknown)); err == nil {
+		t.Errorf("an unknown geojson crs should be refused\n")
+	}
+
+	// as must a crs that conflicts with the declared srs
+	lonlat, _ = os.Open(singleshape)
+	if _, err := DatasetFromGEOJSON("", "", "", lonlat, Options{SRS: 3857}); err == nil {
+		t.Errorf("a geojson crs conflicting with the declared srs should be refused\n")
+	}
+}
+
 func TestKMLData(t *testing.T) {
 
 	// build a map of the testing data and inputs
@@ -243,8 +296,11 @@ func TestGPXData(t *testing.T) {
 			t.Errorf(err.Error())
 		}
 
+		// points3D.gpx was written in UTM meters, not the spec's lon lat, so its srs is guessed
+		opts := Options{GuessSRS: item == points3Dgpx}
+
 		// send the information to the tester
-		results, err := DatasetFromGPX("", "", "", data)
+		results, err := DatasetFromGPX("", "", "", data, opts)
 
 		if err != nil {
 			t.Errorf("[DatasetFromGPX] in pkg [convert], gpx conversion error for %s: %s\n", item, err.Error())
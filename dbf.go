@@ -0,0 +1,160 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// dbfField ... a column of a dbase table
+type dbfField struct {
+	name     string
+	kind     byte // C character, N numeric, F float, L logical, D date
+	length   int
+	decimals int
+}
+
+// dbfTable ... the attributes of a shapefile, one row per shape, nil where a row is deleted
+type dbfTable struct {
+	fields []dbfField
+	rows   [][]string
+}
+
+// readDBF reads a dbase III table, as the .dbf of a shapefile
+func readDBF(contents io.Reader) (*dbfTable, error) {
+	raw, err := ioutil.ReadAll(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) < 32 {
+		return nil, errors.New("dbf header is incomplete")
+	}
+
+	count := int(binary.LittleEndian.Uint32(raw[4:8]))
+	headerLength := int(binary.LittleEndian.Uint16(raw[8:10]))
+	recordLength := int(binary.LittleEndian.Uint16(raw[10:12]))
+
+	if headerLength > len(raw) || recordLength < 1 {
+		return nil, fmt.Errorf("dbf header of %d bytes, records of %d bytes, is corrupt", headerLength, recordLength)
+	}
+
+	// field descriptors are 32 bytes each, until a carriage return
+	var table dbfTable
+	for offset := 32; offset+32 <= headerLength && raw[offset] != 0x0d; offset += 32 {
+		descriptor := raw[offset : offset+32]
+
+		name := descriptor[:11]
+		if end := bytes.IndexByte(name, 0); end >= 0 {
+			name = name[:end]
+		}
+
+		table.fields = append(table.fields, dbfField{
+			name:     strings.TrimSpace(string(name)),
+			kind:     descriptor[11],
+			length:   int(descriptor[16]),
+			decimals: int(descriptor[17]),
+		})
+	}
+
+	for i := 0; i < count; i++ {
+		offset := headerLength + i*recordLength
+		if offset+recordLength > len(raw) {
+			return nil, fmt.Errorf("dbf has %d of %d records", i, count)
+		}
+		record := raw[offset : offset+recordLength]
+
+		// the first byte flags a deleted record
+		if record[0] == '*' {
+			table.rows = append(table.rows, nil)
+			continue
+		}
+
+		row := make([]string, len(table.fields))
+		position := 1
+		for j, field := range table.fields {
+			if position+field.length > len(record) {
+				return nil, fmt.Errorf("dbf record %d is shorter than its fields", i)
+			}
+			row[j] = field.value(record[position : position+field.length])
+			position += field.length
+		}
+		table.rows = append(table.rows, row)
+	}
+
+	return &table, nil
+}
+
+// value reads a field of a record, trimmed, with logicals as true / false and dates as yyyy-mm-dd
+func (field dbfField) value(raw []byte) string {
+	value := strings.TrimSpace(strings.TrimRight(string(raw), "\x00"))
+
+	switch field.kind {
+	case 'L':
+		switch strings.ToUpper(value) {
+		case "T", "Y":
+			return "true"
+		case "F", "N":
+			return "false"
+		}
+		return ""
+
+	case 'D':
+		if len(value) == 8 {
+			return value[:4] + "-" + value[4:6] + "-" + value[6:]
+		}
+
+	case 'N', 'F':
+		// unset numbers are padded with asterisks
+		if strings.Trim(value, "*") == "" {
+			return ""
+		}
+	}
+
+	return value
+}
+
+// properties returns a row as geojson style properties, numbers as float64, with the
+// name, id and styletype columns keyed as ParseGEOJSONAttributes knows them
+func (table *dbfTable) properties(row []string) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for j, field := range table.fields {
+		var value interface{} = row[j]
+		if field.kind == 'N' || field.kind == 'F' {
+			if v, err := strconv.ParseFloat(row[j], 64); err == nil {
+				value = v
+			}
+		}
+
+		properties[field.key()] = value
+	}
+	return properties
+}
+
+// headers returns the keys of properties, in the order of the table's fields
+func (table *dbfTable) headers() []string {
+	var headers []string
+	for _, field := range table.fields {
+		headers = append(headers, field.key())
+	}
+	return headers
+}
+
+// key is the field's name, see propertyKey
+func (field dbfField) key() string {
+	return propertyKey(field.name)
+}
+
+// propertyKey lowercases the names of the columns ParseGEOJSONAttributes knows, eg NAME or FID
+func propertyKey(name string) string {
+	switch strings.ToLower(name) {
+	case "name", "styletype", "id", "fid", "osm_id", "uid", "uuid":
+		return strings.ToLower(name)
+	}
+	return name
+}
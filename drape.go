@@ -0,0 +1,52 @@
+package convert
+
+import (
+	"math"
+)
+
+const (
+	// meters in a degree of latitude, near enough for sample spacing
+	metersPerDegree = 111320
+
+	// the most vertices inserted into a single segment
+	maxDensify = 10000
+)
+
+// drapeSpacing is the declared spacing in meters, or the provider's cell size
+func (o *Options) drapeSpacing(provider ElevationProvider) float64 {
+	if o.DrapeSpacing > 0 {
+		return o.DrapeSpacing
+	}
+
+	spacing := arcSecond
+	if p, ok := provider.(gridSpacing); ok {
+		spacing = p.spacing()
+	}
+	return spacing * metersPerDegree
+}
+
+// densify inserts vertices along each segment of an EPSG:3857 line, every spacing meters on the ground,
+// with z interpolated between the ends (NaN where they have none)
+func densify(line [][]float64, spacing float64) [][]float64 {
+	if len(line) < 2 || spacing <= 0 {
+		return line
+	}
+
+	dense := [][]float64{line[0]}
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+
+		// web mercator meters grow with latitude
+		_, lat := webMercatorTo4326((a[0]+b[0])/2, (a[1]+b[1])/2)
+		ground := math.Hypot(b[0]-a[0], b[1]-a[1]) * math.Cos(lat*deg2rad)
+
+		n := int(math.Min(math.Ceil(ground/spacing), maxDensify))
+		for k := 1; k < n; k++ {
+			f := float64(k) / float64(n)
+			dense = append(dense, []float64{roundCm(a[0] + f*(b[0]-a[0])), roundCm(a[1] + f*(b[1]-a[1])), a[2] + f*(b[2]-a[2])})
+		}
+		dense = append(dense, b)
+	}
+
+	return dense
+}
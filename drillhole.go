@@ -0,0 +1,905 @@
+package convert
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DesurveyMethod ... how the hole path is built between survey stations
+type DesurveyMethod string
+
+const (
+	// Tangent holds the direction of the upper station to the next station
+	Tangent DesurveyMethod = "tangent"
+
+	// BalancedTangent averages the directions of the upper and lower stations
+	BalancedTangent DesurveyMethod = "balancedtangent"
+
+	// MinimumCurvature fits a circular arc between stations, the industry default
+	MinimumCurvature DesurveyMethod = "minimumcurvature"
+)
+
+// DipSign ... which sign of dip points a hole down, as exports disagree
+type DipSign string
+
+const (
+	// AutoDip takes every dip as downward when they all share a sign, as surface holes do
+	// whichever the convention.  Dips of both signs are read as NegativeDown, with a warning.
+	AutoDip DipSign = ""
+
+	// NegativeDown reads -60 as down and 30 as up, eg underground holes drilled up from a drive
+	NegativeDown DipSign = "negativedown"
+
+	// PositiveDown reads 60 as down and -30 as up
+	PositiveDown DipSign = "positivedown"
+)
+
+// DrillholeFields ... names the columns of a drillhole csv, where each row is an interval
+// of a hole carrying its own azimuth and dip, and the XYZ of the shallowest row is the collar
+type DrillholeFields struct {
+	HoleID  string         `json:"holeid" yaml:"holeid"`
+	X       string         `json:"xfield" yaml:"xfield"`
+	Y       string         `json:"yfield" yaml:"yfield"`
+	Z       string         `json:"zfield" yaml:"zfield"`
+	Azimuth string         `json:"azimuth" yaml:"azimuth"`
+	Dip     string         `json:"dip" yaml:"dip"`
+	From    string         `json:"from" yaml:"from"`
+	To      string         `json:"to" yaml:"to"`
+	Method  DesurveyMethod `json:"method" yaml:"method"`
+	DipSign DipSign        `json:"dipsign" yaml:"dipsign"`
+
+	// composite the intervals before they're drawn, nil to draw every interval
+	Composite *Composite `json:"composite" yaml:"composite"`
+}
+
+// DrillholeTables ... names the columns of the three table drillhole model, a collar table,
+// a survey table of downhole stations, and an interval table of assays or logging
+type DrillholeTables struct {
+	Collar   CollarFields   `json:"collar" yaml:"collar"`
+	Survey   SurveyFields   `json:"survey" yaml:"survey"`
+	Interval IntervalFields `json:"interval" yaml:"interval"`
+	Method   DesurveyMethod `json:"method" yaml:"method"`
+	DipSign  DipSign        `json:"dipsign" yaml:"dipsign"`
+
+	// composite the intervals before they're drawn, nil to draw every interval
+	Composite *Composite `json:"composite" yaml:"composite"`
+}
+
+// CollarFields ... the collar table columns, Z and Depth are optional
+type CollarFields struct {
+	HoleID string `json:"holeid" yaml:"holeid"`
+	X      string `json:"xfield" yaml:"xfield"`
+	Y      string `json:"yfield" yaml:"yfield"`
+	Z      string `json:"zfield" yaml:"zfield"`
+	Depth  string `json:"depth" yaml:"depth"`
+}
+
+// SurveyFields ... the survey table columns
+type SurveyFields struct {
+	HoleID  string `json:"holeid" yaml:"holeid"`
+	Depth   string `json:"depth" yaml:"depth"`
+	Azimuth string `json:"azimuth" yaml:"azimuth"`
+	Dip     string `json:"dip" yaml:"dip"`
+}
+
+// IntervalFields ... the interval table columns, every other column is an attribute
+type IntervalFields struct {
+	HoleID string `json:"holeid" yaml:"holeid"`
+	From   string `json:"from" yaml:"from"`
+	To     string `json:"to" yaml:"to"`
+}
+
+// Drillhole ... a collar, its downhole survey, and its sampled intervals
+type Drillhole struct {
+	ID        string
+	Collar    []float64 // x y (z) in the declared srs
+	Depth     float64   // total depth, the deepest interval if unknown
+	Surveys   []Survey
+	Intervals []Interval
+
+	cleaned bool
+}
+
+// Survey ... a downhole survey station, azimuth from north and dip below horizontal, negative
+// above it, in degrees
+type Survey struct {
+	Depth   float64
+	Azimuth float64
+	Dip     float64
+}
+
+// Interval ... a sampled or logged length of hole
+type Interval struct {
+	From       float64
+	To         float64
+	Attributes []Attribute
+}
+
+// DatasetFromDrillholes converts a drillhole csv into each hole's desurveyed 3D trace,
+// plus a line segment per interval carrying the interval's attributes (eg assays, lithology).
+// The collar srs is Options.SRS, or guessed from the magnitude of its x y with Options.GuessSRS.
+func DatasetFromDrillholes(fields DrillholeFields, contents io.Reader, opts ...Options) (*Datasets, error) {
+
+	// ensure demvrt is set, unless an elevation provider is declared
+	options, err := resolveOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var outdataset Datasets
+
+	raw, err := csv.NewReader(contents).ReadAll()
+	if err != nil {
+		return &outdataset, err
+	}
+
+	if len(raw) < 2 {
+		return &outdataset, errors.New("no data in dataset")
+	}
+
+	holes, err := parseDrillholeRows(fields, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := orientDips(holes, fields.DipSign); err != nil {
+		return nil, err
+	}
+
+	return datasetFromHoles(holes, fields.Method, compositeExcluding(fields.Composite, fields.From, fields.To), options)
+}
+
+// compositeExcluding copies the composite, leaving the from and to columns out of its attributes
+func compositeExcluding(composite *Composite, fields ...string) *Composite {
+	if composite == nil {
+		return nil
+	}
+	c := *composite
+	c.Exclude = append(append([]string(nil), c.Exclude...), fields...)
+	return &c
+}
+
+// datasetFromHoles desurveys each hole into a new dataset, compositing its intervals if asked
+func datasetFromHoles(holes []*Drillhole, method DesurveyMethod, composite *Composite, options *Options) (*Datasets, error) {
+	var outdataset Datasets
+
+	container := initExtentContainer(options)
+
+	for _, hole := range holes {
+		if composite != nil {
+			hole.clean()
+			hole.Intervals = hole.Composite(*composite)
+		}
+
+		if err := ParseDrillhole(hole, method, &outdataset, container); err != nil {
+			fmt.Printf("NonFatal [ParseDrillhole] hole %s encountered %v\n", hole.ID, err.Error())
+		}
+	}
+
+	// close the BBOXlistener goroutine
+	close(container.ch)
+
+	// make sure there's valid features in the dataset
+	if len(outdataset.Lines) == 0 {
+		return nil, errors.New("no valid drillholes in dataset")
+	}
+
+	// configure the center point... in 4326
+	c, err := getCenter(container)
+	if err != nil {
+		return nil, err
+	}
+	outdataset.Center = append(outdataset.Center, c)
+
+	// configure the s2 array... in 4326
+	outdataset.S2 = s2covering(container)
+
+	// record how the dataset was read
+	outdataset.Metadata = container.options().metadata()
+
+	return &outdataset, nil
+}
+
+// DatasetFromDrillholeTables converts the three table drillhole model into each hole's desurveyed
+// 3D trace, plus a line segment per interval.  The interval table is optional, pass nil for traces only.
+// A hole missing from the survey table is taken as vertical.  The srs is declared as for
+// DatasetFromDrillholes.
+func DatasetFromDrillholeTables(fields DrillholeTables, collars io.Reader, surveys io.Reader, intervals io.Reader, opts ...Options) (*Datasets, error) {
+
+	// ensure demvrt is set, unless an elevation provider is declared
+	options, err := resolveOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// collars
+	rows, err := readDrillholeTable(collars, fields.Collar.HoleID, fields.Collar.X, fields.Collar.Y)
+	if err != nil {
+		return nil, fmt.Errorf("collar table: %v", err)
+	}
+
+	var holes []*Drillhole
+	byID := make(map[string]*Drillhole)
+	for _, row := range rows {
+		id := row[fields.Collar.HoleID]
+		if _, ok := byID[id]; ok {
+			fmt.Printf("NonFatal [DatasetFromDrillholeTables] hole %s has more than one collar, skipping the repeat\n", id)
+			continue
+		}
+
+		collar, err := parseFloats(row[fields.Collar.X], row[fields.Collar.Y], row[fields.Collar.Z])
+		if err != nil {
+			fmt.Printf("NonFatal [DatasetFromDrillholeTables] hole %s has an invalid collar: %v\n", id, err.Error())
+			continue
+		}
+
+		hole := &Drillhole{ID: id, Collar: collar}
+		if depth, err := strconv.ParseFloat(row[fields.Collar.Depth], 64); err == nil {
+			hole.Depth = depth
+		}
+
+		byID[id] = hole
+		holes = append(holes, hole)
+	}
+
+	// surveys
+	if surveys != nil {
+		rows, err := readDrillholeTable(surveys, fields.Survey.HoleID, fields.Survey.Depth, fields.Survey.Azimuth, fields.Survey.Dip)
+		if err != nil {
+			return nil, fmt.Errorf("survey table: %v", err)
+		}
+
+		for _, row := range rows {
+			hole, ok := byID[row[fields.Survey.HoleID]]
+			if !ok {
+				fmt.Printf("NonFatal [DatasetFromDrillholeTables] survey of hole %s has no collar, skipping\n", row[fields.Survey.HoleID])
+				continue
+			}
+
+			station, err := parseFloats(row[fields.Survey.Depth], row[fields.Survey.Azimuth], row[fields.Survey.Dip])
+			if err != nil || len(station) < 3 {
+				fmt.Printf("NonFatal [DatasetFromDrillholeTables] hole %s has an invalid survey, skipping\n", hole.ID)
+				continue
+			}
+
+			hole.Surveys = append(hole.Surveys, Survey{Depth: station[0], Azimuth: station[1], Dip: station[2]})
+		}
+	}
+
+	// intervals
+	if intervals != nil {
+		headers, rows, err := readDrillholeTableHeaders(intervals, fields.Interval.HoleID, fields.Interval.From, fields.Interval.To)
+		if err != nil {
+			return nil, fmt.Errorf("interval table: %v", err)
+		}
+
+		consumed := map[string]bool{fields.Interval.HoleID: true}
+
+		for _, row := range rows {
+			hole, ok := byID[row[fields.Interval.HoleID]]
+			if !ok {
+				fmt.Printf("NonFatal [DatasetFromDrillholeTables] interval of hole %s has no collar, skipping\n", row[fields.Interval.HoleID])
+				continue
+			}
+
+			fromto, err := parseFloats(row[fields.Interval.From], row[fields.Interval.To])
+			if err != nil {
+				fmt.Printf("NonFatal [DatasetFromDrillholeTables] hole %s has an interval without from / to, skipping\n", hole.ID)
+				continue
+			}
+
+			interval := Interval{From: fromto[0], To: fromto[1]}
+			for _, header := range headers {
+				if consumed[header] || row[header] == "" {
+					continue
+				}
+				interval.Attributes = append(interval.Attributes, Attribute{Key: header, Value: row[header]})
+			}
+			hole.Intervals = append(hole.Intervals, interval)
+		}
+	}
+
+	if err := orientDips(holes, fields.DipSign); err != nil {
+		return nil, err
+	}
+
+	for _, hole := range holes {
+		// without a survey, a hole is vertical
+		if len(hole.Surveys) == 0 {
+			fmt.Printf("Warning: [DatasetFromDrillholeTables] hole %s has no survey, taken as vertical\n", hole.ID)
+			hole.Surveys = []Survey{{Depth: 0, Azimuth: 0, Dip: 90}}
+		}
+
+		// without a declared depth, the hole ends at its deepest interval or survey
+		if hole.Depth == 0 {
+			for _, interval := range hole.Intervals {
+				hole.Depth = math.Max(hole.Depth, interval.To)
+			}
+			for _, survey := range hole.Surveys {
+				hole.Depth = math.Max(hole.Depth, survey.Depth)
+			}
+		}
+	}
+
+	return datasetFromHoles(holes, fields.Method, compositeExcluding(fields.Composite, fields.Interval.From, fields.Interval.To), options)
+}
+
+// readDrillholeTable reads a csv table into rows keyed by header, requiring the given fields
+func readDrillholeTable(contents io.Reader, required ...string) ([]map[string]string, error) {
+	_, rows, err := readDrillholeTableHeaders(contents, required...)
+	return rows, err
+}
+
+// readDrillholeTableHeaders is readDrillholeTable, also returning the headers in order
+func readDrillholeTableHeaders(contents io.Reader, required ...string) ([]string, []map[string]string, error) {
+	raw, err := csv.NewReader(contents).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(raw) < 2 {
+		return nil, nil, errors.New("no data in table")
+	}
+
+	headers := raw[0]
+	for _, field := range required {
+		var found bool
+		for _, header := range headers {
+			if header == field {
+				found = true
+			}
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("field %q is not in the csv headers", field)
+		}
+	}
+
+	var rows []map[string]string
+	for _, record := range raw[1:] {
+		row := make(map[string]string)
+		for i, header := range headers {
+			if i < len(record) {
+				row[header] = strings.TrimSpace(record[i])
+			}
+		}
+		if row[required[0]] == "" {
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	return headers, rows, nil
+}
+
+// parseDrillholeRows groups the csv rows by hole, in order of appearance
+func parseDrillholeRows(fields DrillholeFields, raw [][]string) ([]*Drillhole, error) {
+	headers := make(map[string]int)
+	for i, header := range raw[0] {
+		headers[header] = i
+	}
+
+	for _, field := range []string{fields.HoleID, fields.X, fields.Y, fields.Azimuth, fields.Dip, fields.From, fields.To} {
+		if _, ok := headers[field]; !ok {
+			return nil, fmt.Errorf("drillhole field %q is not in the csv headers", field)
+		}
+	}
+
+	// these fields are consumed by the geometry, the rest are interval attributes
+	consumed := map[string]bool{fields.HoleID: true, fields.X: true, fields.Y: true, fields.Z: true, fields.Azimuth: true, fields.Dip: true}
+
+	var holes []*Drillhole
+	byID := make(map[string]*Drillhole)
+	collarDepth := make(map[string]float64)
+
+	for _, record := range raw[1:] {
+		value := func(field string) string {
+			i, ok := headers[field]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		id := value(fields.HoleID)
+		if id == "" {
+			continue
+		}
+
+		hole, ok := byID[id]
+		if !ok {
+			hole = &Drillhole{ID: id}
+			byID[id] = hole
+			holes = append(holes, hole)
+		}
+
+		from, errFrom := strconv.ParseFloat(value(fields.From), 64)
+		to, errTo := strconv.ParseFloat(value(fields.To), 64)
+		if errFrom != nil || errTo != nil {
+			fmt.Printf("NonFatal [DatasetFromDrillholes] hole %s has a row without from / to, skipping\n", id)
+			continue
+		}
+
+		// the shallowest row holds the collar
+		if depth, seen := collarDepth[id]; !seen || from < depth {
+			collar, err := parseFloats(value(fields.X), value(fields.Y), value(fields.Z))
+			if err == nil {
+				hole.Collar = collar
+				collarDepth[id] = from
+			}
+		}
+
+		// each row carries the hole direction at its from depth
+		azimuth, errAz := strconv.ParseFloat(value(fields.Azimuth), 64)
+		dip, errDip := strconv.ParseFloat(value(fields.Dip), 64)
+		if errAz == nil && errDip == nil {
+			hole.Surveys = append(hole.Surveys, Survey{Depth: from, Azimuth: azimuth, Dip: dip})
+		}
+
+		interval := Interval{From: from, To: to}
+		for header, i := range headers {
+			if consumed[header] || i >= len(record) || strings.TrimSpace(record[i]) == "" {
+				continue
+			}
+			interval.Attributes = append(interval.Attributes, Attribute{Key: header, Value: record[i]})
+		}
+		sortAttributes(interval.Attributes, raw[0])
+		hole.Intervals = append(hole.Intervals, interval)
+
+		if to > hole.Depth {
+			hole.Depth = to
+		}
+	}
+
+	return holes, nil
+}
+
+// parseFloats parses x, y and an optional z
+func parseFloats(values ...string) ([]float64, error) {
+	var floats []float64
+	for i, value := range values {
+		if value == "" && i >= 2 {
+			break
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		floats = append(floats, f)
+	}
+	return floats, nil
+}
+
+// sortAttributes keeps attributes in the order of the csv headers, map iteration is random
+func sortAttributes(attributes []Attribute, headers []string) {
+	order := make(map[string]int)
+	for i, header := range headers {
+		order[header] = i
+	}
+	sort.SliceStable(attributes, func(i, j int) bool {
+		return order[attributes[i].Key] < order[attributes[j].Key]
+	})
+}
+
+// ParseDrillhole desurveys a hole, appending its trace and its intervals to the dataset as Lines
+func ParseDrillhole(hole *Drillhole, method DesurveyMethod, outdataset *Datasets, container *ExtentContainer) error {
+	if method == "" {
+		method = MinimumCurvature
+	}
+
+	if len(hole.Collar) < 2 {
+		return errors.New("no collar coordinate")
+	}
+
+	if len(hole.Surveys) == 0 {
+		return errors.New("no azimuth / dip to desurvey with")
+	}
+
+	hole.clean()
+
+	// cleaning drops the surveys beyond the total depth, perhaps all of them
+	if len(hole.Surveys) == 0 {
+		return errors.New("no azimuth / dip within the total depth to desurvey with")
+	}
+
+	// the trace runs through every survey station and interval boundary
+	depths := []float64{0, hole.Depth}
+	for _, survey := range hole.Surveys {
+		depths = append(depths, survey.Depth)
+	}
+	for _, interval := range hole.Intervals {
+		depths = append(depths, interval.From, interval.To)
+	}
+	depths = uniqueDepths(depths, 0, hole.Depth)
+
+	trace, err := hole.trace(method, depths, container)
+	if err != nil {
+		return err
+	}
+
+	newfeature := Lines{ID: hole.ID, Name: hole.ID, StyleType: "drillhole"}
+	newfeature.Attributes = []Attribute{
+		{Key: "holeid", Value: hole.ID},
+		{Key: "depth", Value: strconv.FormatFloat(hole.Depth, 'f', -1, 64)},
+		{Key: "desurvey", Value: string(method)},
+	}
+	newfeature.Points = trace
+	outdataset.Lines = append(outdataset.Lines, newfeature)
+
+	for _, interval := range hole.Intervals {
+		segment, err := hole.trace(method, uniqueDepths(depths, interval.From, interval.To), container)
+		if err != nil {
+			return err
+		}
+
+		// a zero length interval has nothing to draw
+		if len(segment) < 2 {
+			continue
+		}
+
+		newfeature := Lines{Name: hole.ID, StyleType: "interval", Attributes: interval.Attributes}
+		newfeature.ID = fmt.Sprintf("%s_%v_%v", hole.ID, interval.From, interval.To)
+		newfeature.Points = segment
+		outdataset.Lines = append(outdataset.Lines, newfeature)
+	}
+
+	return nil
+}
+
+// clean reports what's wrong with the hole, and drops what can't be drawn, only once
+func (hole *Drillhole) clean() {
+	if hole.cleaned {
+		return
+	}
+	hole.cleaned = true
+
+	dropped := make(map[int]bool)
+	droppedSurveys := make(map[int]bool)
+	for _, issue := range hole.Validate() {
+		switch issue.Kind {
+		case IntervalGap:
+			fmt.Printf("Warning: [ParseDrillhole] %v\n", issue.Error())
+			continue
+		case IntervalOverlap, IntervalBeyondDepth:
+			dropped[issue.Index] = true
+		case SurveyBeyondDepth, DuplicateSurvey:
+			droppedSurveys[issue.Index] = true
+		}
+		fmt.Printf("NonFatal [ParseDrillhole] %v, skipping\n", issue.Error())
+	}
+
+	var intervals []Interval
+	for i, interval := range hole.Intervals {
+		if !dropped[i] {
+			intervals = append(intervals, interval)
+		}
+	}
+	hole.Intervals = intervals
+
+	var surveys []Survey
+	for i, survey := range hole.Surveys {
+		if !droppedSurveys[i] {
+			surveys = append(surveys, survey)
+		}
+	}
+	hole.Surveys = surveys
+}
+
+// kinds of DrillholeIssue
+const (
+	IntervalGap         = "gap"
+	IntervalOverlap     = "overlap"
+	IntervalBeyondDepth = "interval beyond total depth"
+	SurveyBeyondDepth   = "survey beyond total depth"
+	DuplicateSurvey     = "duplicate survey depth"
+)
+
+// DrillholeIssue ... a problem found validating a hole
+type DrillholeIssue struct {
+	HoleID string
+	Kind   string
+	Index  int // of the interval or survey at fault, once sorted by depth
+	From   float64
+	To     float64
+}
+
+func (issue DrillholeIssue) Error() string {
+	if issue.Kind == SurveyBeyondDepth || issue.Kind == DuplicateSurvey {
+		return fmt.Sprintf("hole %s has a %s at %vm", issue.HoleID, issue.Kind, issue.From)
+	}
+	return fmt.Sprintf("hole %s has an %s from %vm to %vm", issue.HoleID, issue.Kind, issue.From, issue.To)
+}
+
+// Validate sorts the surveys and intervals by depth, and reports gaps and overlaps between
+// intervals, intervals or surveys beyond the total depth, and surveys repeating a depth
+func (hole *Drillhole) Validate() []DrillholeIssue {
+	var issues []DrillholeIssue
+
+	sort.SliceStable(hole.Surveys, func(i, j int) bool { return hole.Surveys[i].Depth < hole.Surveys[j].Depth })
+	sort.SliceStable(hole.Intervals, func(i, j int) bool { return hole.Intervals[i].From < hole.Intervals[j].From })
+
+	for i, survey := range hole.Surveys {
+		switch {
+		case hole.Depth > 0 && survey.Depth > hole.Depth:
+			issues = append(issues, DrillholeIssue{HoleID: hole.ID, Kind: SurveyBeyondDepth, Index: i, From: survey.Depth})
+		case i > 0 && survey.Depth == hole.Surveys[i-1].Depth:
+			issues = append(issues, DrillholeIssue{HoleID: hole.ID, Kind: DuplicateSurvey, Index: i, From: survey.Depth})
+		}
+	}
+
+	// the deepest interval kept so far, a dropped interval doesn't count
+	var bottom float64
+	for i, interval := range hole.Intervals {
+		issue := DrillholeIssue{HoleID: hole.ID, Index: i, From: interval.From, To: interval.To}
+
+		switch {
+		case hole.Depth > 0 && interval.To > hole.Depth:
+			issue.Kind = IntervalBeyondDepth
+		case interval.To < interval.From, interval.From < bottom:
+			issue.Kind = IntervalOverlap
+		case interval.From > bottom:
+			issues = append(issues, DrillholeIssue{HoleID: hole.ID, Kind: IntervalGap, Index: i, From: bottom, To: interval.From})
+		}
+
+		if issue.Kind != "" {
+			issues = append(issues, issue)
+			continue
+		}
+		bottom = interval.To
+	}
+
+	return issues
+}
+
+// uniqueDepths sorts the depths within from and to, and drops duplicates
+func uniqueDepths(depths []float64, from float64, to float64) []float64 {
+	sorted := append([]float64{from, to}, depths...)
+	sort.Float64s(sorted)
+
+	var unique []float64
+	for _, depth := range sorted {
+		if depth < from || depth > to {
+			continue
+		}
+		if len(unique) > 0 && depth-unique[len(unique)-1] < 1e-6 {
+			continue
+		}
+		unique = append(unique, depth)
+	}
+	return unique
+}
+
+// trace desurveys the hole at the given depths, and places the result in EPSG:3857
+func (hole *Drillhole) trace(method DesurveyMethod, depths []float64, container *ExtentContainer) ([][]float64, error) {
+	offsets := hole.Desurvey(method, depths)
+
+	// depths are logged in the vertical units, eg feet in the US, the offsets are in meters
+	toMeter := container.options().VerticalUnits.toMeter()
+	for i := range offsets {
+		offsets[i][0] *= toMeter
+		offsets[i][1] *= toMeter
+		offsets[i][2] *= toMeter
+	}
+
+	// the collar z by the altitude mode, from the dem if the csv doesn't have one
+	z, err := container.options().collarElevation(hole.Collar)
+	if err != nil {
+		return nil, err
+	}
+	collar := []float64{hole.Collar[0], hole.Collar[1], z}
+
+	var coords [][]float64
+	for _, offset := range offsets {
+		x, y, err := container.options().offsetCoord(collar[0], collar[1], offset[0], offset[1])
+		if err != nil {
+			return nil, err
+		}
+		coords = append(coords, []float64{x, y, collar[2] + offset[2]})
+	}
+
+	// the trace hangs from the collar, so is already absolute
+	parsed, err := container.options().placed().checkCoordsBatch(coords)
+	if err != nil {
+		return nil, err
+	}
+
+	// only test bbox if channel is valid
+	if container != nil {
+		for _, point := range parsed {
+			container.ch <- point
+		}
+	}
+
+	return parsed, nil
+}
+
+// Desurvey returns the east, north, and up offsets from the collar at each depth, in the units
+// of the depths.  A hole without surveys is taken as vertical.
+func (hole *Drillhole) Desurvey(method DesurveyMethod, depths []float64) [][3]float64 {
+	stations := append([]Survey(nil), hole.Surveys...)
+	if len(stations) == 0 {
+		stations = []Survey{{Depth: 0, Azimuth: 0, Dip: 90}}
+	}
+	sort.SliceStable(stations, func(i, j int) bool { return stations[i].Depth < stations[j].Depth })
+
+	// the collar takes the direction of the shallowest survey
+	if stations[0].Depth > 0 {
+		stations = append([]Survey{{Depth: 0, Azimuth: stations[0].Azimuth, Dip: stations[0].Dip}}, stations...)
+	}
+
+	// position of every station
+	positions := [][3]float64{{0, 0, 0}}
+	for i := 1; i < len(stations); i++ {
+		step := desurveyStep(method, stations[i-1], stations[i])
+		prev := positions[i-1]
+		positions = append(positions, [3]float64{prev[0] + step[0], prev[1] + step[1], prev[2] + step[2]})
+	}
+
+	var offsets [][3]float64
+	for _, depth := range depths {
+
+		// the station at or above the depth
+		i := sort.Search(len(stations), func(i int) bool { return stations[i].Depth > depth }) - 1
+		if i < 0 {
+			i = 0
+		}
+
+		upper := stations[i]
+
+		// interpolate a station at the depth, beyond the last station the hole runs straight
+		at := Survey{Depth: depth, Azimuth: upper.Azimuth, Dip: upper.Dip}
+		if i+1 < len(stations) && method != Tangent {
+			lower := stations[i+1]
+			f := (depth - upper.Depth) / (lower.Depth - upper.Depth)
+			at.Azimuth, at.Dip = interpolateDirection(upper, lower, f)
+		}
+
+		step := desurveyStep(method, upper, at)
+		offsets = append(offsets, [3]float64{positions[i][0] + step[0], positions[i][1] + step[1], positions[i][2] + step[2]})
+	}
+
+	return offsets
+}
+
+// orientDips turns the dips of the holes, read by the sign convention, to dips below horizontal
+func orientDips(holes []*Drillhole, sign DipSign) error {
+	down, up := false, false
+	for _, hole := range holes {
+		for _, survey := range hole.Surveys {
+			down = down || survey.Dip < 0
+			up = up || survey.Dip > 0
+		}
+	}
+
+	switch sign {
+	case AutoDip:
+		if down && up {
+			fmt.Printf("Warning: [orientDips] in pkg [convert] found dips of both signs, read as negative down, declare the DipSign\n")
+			sign = NegativeDown
+		}
+	case NegativeDown, PositiveDown:
+	default:
+		return fmt.Errorf("unknown dip sign %q, use negativedown or positivedown", sign)
+	}
+
+	for _, hole := range holes {
+		for i := range hole.Surveys {
+			dip := &hole.Surveys[i].Dip
+			switch sign {
+			case AutoDip:
+				*dip = math.Abs(*dip)
+			case NegativeDown:
+				*dip = -*dip
+			}
+		}
+	}
+	return nil
+}
+
+// direction is the unit vector east, north, up of an azimuth and dip below horizontal
+func direction(azimuth float64, dip float64) [3]float64 {
+	az := azimuth * deg2rad
+	dp := dip * deg2rad
+	return [3]float64{math.Cos(dp) * math.Sin(az), math.Cos(dp) * math.Cos(az), -math.Sin(dp)}
+}
+
+// doglegAngle is the angle between two unit vectors
+func doglegAngle(t1 [3]float64, t2 [3]float64) float64 {
+	dot := t1[0]*t2[0] + t1[1]*t2[1] + t1[2]*t2[2]
+	return math.Acos(math.Max(-1, math.Min(1, dot)))
+}
+
+// desurveyStep is the east, north, up displacement between two stations
+func desurveyStep(method DesurveyMethod, upper Survey, lower Survey) [3]float64 {
+	length := lower.Depth - upper.Depth
+	t1 := direction(upper.Azimuth, upper.Dip)
+	t2 := direction(lower.Azimuth, lower.Dip)
+
+	switch method {
+	case Tangent:
+		return [3]float64{length * t1[0], length * t1[1], length * t1[2]}
+
+	case BalancedTangent:
+		return [3]float64{length / 2 * (t1[0] + t2[0]), length / 2 * (t1[1] + t2[1]), length / 2 * (t1[2] + t2[2])}
+	}
+
+	// minimum curvature, the balanced tangent bent onto an arc by the ratio factor
+	rf := 1.0
+	if dl := doglegAngle(t1, t2); dl > 1e-9 {
+		rf = 2 / dl * math.Tan(dl/2)
+	}
+	return [3]float64{length / 2 * (t1[0] + t2[0]) * rf, length / 2 * (t1[1] + t2[1]) * rf, length / 2 * (t1[2] + t2[2]) * rf}
+}
+
+// interpolateDirection finds the direction a fraction f of the way along the arc between two stations
+func interpolateDirection(upper Survey, lower Survey, f float64) (float64, float64) {
+	t1 := direction(upper.Azimuth, upper.Dip)
+	t2 := direction(lower.Azimuth, lower.Dip)
+
+	// spherical interpolation, which is exactly the minimum curvature arc
+	w1, w2 := 1-f, f
+	if dl := doglegAngle(t1, t2); dl > 1e-9 {
+		w1 = math.Sin((1-f)*dl) / math.Sin(dl)
+		w2 = math.Sin(f*dl) / math.Sin(dl)
+	}
+
+	t := [3]float64{w1*t1[0] + w2*t2[0], w1*t1[1] + w2*t2[1], w1*t1[2] + w2*t2[2]}
+	norm := math.Sqrt(t[0]*t[0] + t[1]*t[1] + t[2]*t[2])
+
+	azimuth := math.Atan2(t[0], t[1]) * rad2deg
+	dip := math.Asin(-t[2]/norm) * rad2deg
+
+	return azimuth, dip
+}
+
+// collarElevation resolves the collar z by the altitude mode, filling it from the dem if missing
+func (o *Options) collarElevation(collar []float64) (float64, error) {
+	coord, err := o.checkCoords(collar)
+	if err != nil {
+		return 0, err
+	}
+	return coord[2], nil
+}
+
+// offsetCoord moves an x y of the declared srs by east and north meters on the ground
+func (o *Options) offsetCoord(x float64, y float64, east float64, north float64) (float64, float64, error) {
+	srs, err := o.crs()
+	if err != nil {
+		return x, y, err
+	}
+
+	// a mine grid is its own ground, azimuths are relative to its north, and a unit of the grid
+	// is Scale units of its srs, eg 0.3048 for a grid in feet on UTM
+	if o.MineGrid != nil {
+		toMeter := o.MineGrid.Scale * srs.toMeter()
+		return x + east/toMeter, y + north/toMeter, nil
+	}
+
+	switch {
+	case srs == nil && x >= -180 && x <= 180 && y >= -180 && y <= 180, srs != nil && srs.IsGeographic():
+		// degrees, scaled by the radii of curvature of the ellipsoid
+		es := wgs84.es()
+		sin := math.Sin(y * deg2rad)
+		n := wgs84.A / math.Sqrt(1-es*sin*sin)
+		m := wgs84.A * (1 - es) / math.Pow(1-es*sin*sin, 1.5)
+		return x + east/(n*math.Cos(y*deg2rad))*rad2deg, y + north/m*rad2deg, nil
+
+	case srs == nil, srs.IsWebMercator():
+		// web mercator meters grow with latitude
+		_, lat := webMercatorTo4326(x, y)
+		scale := 1 / math.Cos(lat*deg2rad)
+		return x + east*scale, y + north*scale, nil
+	}
+
+	// projected, in the units of the crs or those declared
+	toMeter := srs.toMeter()
+	if o.HorizontalUnits != "" {
+		toMeter = o.HorizontalUnits.toMeter()
+	}
+	return x + east/toMeter, y + north/toMeter, nil
+}
@@ -0,0 +1,431 @@
+package convert
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+const (
+	//drillhole testing datasets
+	drillholes = "tests/trek/trek_drilldata.csv"
+
+	collars        = "tests/drillholes/collar.csv"
+	surveys        = "tests/drillholes/survey.csv"
+	drillintervals = "tests/drillholes/assay.csv"
+)
+
+var tableFields = DrillholeTables{
+	Collar:   CollarFields{HoleID: "HOLEID", X: "EASTING", Y: "NORTHING", Z: "RL", Depth: "MAXDEPTH"},
+	Survey:   SurveyFields{HoleID: "HOLEID", Depth: "DEPTH", Azimuth: "AZIMUTH", Dip: "DIP"},
+	Interval: IntervalFields{HoleID: "HOLEID", From: "FROM", To: "TO"},
+}
+
+var trekFields = DrillholeFields{
+	HoleID:  "hold_id",
+	X:       "utm_east",
+	Y:       "utm_north",
+	Z:       "elev_m",
+	Azimuth: "azimuth",
+	Dip:     "dip",
+	From:    "from_m",
+	To:      "to_m",
+}
+
+func TestDrillholeData(t *testing.T) {
+
+	for _, method := range []DesurveyMethod{Tangent, BalancedTangent, MinimumCurvature} {
+		file, err := os.Open(drillholes)
+		if err != nil {
+			t.Errorf(err.Error())
+			return
+		}
+
+		fields := trekFields
+		fields.Method = method
+
+		dataset, err := DatasetFromDrillholes(fields, file, Options{SRS: 3857})
+		file.Close()
+		if err != nil {
+			t.Errorf("%s: %v", method, err.Error())
+			continue
+		}
+
+		var traces, intervals int
+		for _, line := range dataset.Lines {
+			switch line.StyleType {
+			case "drillhole":
+				traces++
+			case "interval":
+				intervals++
+			}
+		}
+
+		if traces != 15 {
+			t.Errorf("%s: expected 15 drillhole traces, got %d\n", method, traces)
+		}
+
+		if intervals < 1900 {
+			t.Errorf("%s: expected an interval per sample, got %d\n", method, intervals)
+		}
+
+		// TRK08-01 is straight at 245 / 70, the end of hole row starts 194.77m downhole
+		trace := dataset.Lines[0]
+		end := trace.Points[len(trace.Points)-2]
+		if end[2] > 1280-194.77*math.Sin(70*deg2rad)+0.01 || end[2] < 1280-194.77*math.Sin(70*deg2rad)-0.01 {
+			t.Errorf("%s: TRK08-01 ended at elevation %v\n", method, end[2])
+		}
+		// the csv positions are whole meters from another desurvey, so only roughly
+		if math.Abs(end[0]+14615866) > 5 || math.Abs(end[1]-7772574) > 5 {
+			t.Errorf("%s: TRK08-01 ended at %v, the csv has -14615866, 7772574\n", method, end)
+		}
+
+		// an interval carries its assays, the first is the collar's casing
+		var found bool
+		for _, attribute := range dataset.Lines[2].Attributes {
+			if attribute.Key == "copper" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: interval %s lost its assays: %v\n", method, dataset.Lines[2].ID, dataset.Lines[2].Attributes)
+		}
+	}
+}
+
+func TestDesurveyMethods(t *testing.T) {
+
+	// a hole building 90 degrees from vertical to horizontal over 100m
+	hole := Drillhole{
+		ID:      "arc",
+		Collar:  []float64{0, 0, 0},
+		Depth:   100,
+		Surveys: []Survey{{Depth: 0, Azimuth: 90, Dip: 90}, {Depth: 100, Azimuth: 90, Dip: 0}},
+	}
+
+	// the minimum curvature arc has a radius of 200/pi
+	radius := 200 / math.Pi
+	offsets := hole.Desurvey(MinimumCurvature, []float64{50, 100})
+	if math.Abs(offsets[1][0]-radius) > 1e-6 || math.Abs(offsets[1][2]+radius) > 1e-6 {
+		t.Errorf("minimum curvature ended at %v, expected %v, 0, %v\n", offsets[1], radius, -radius)
+	}
+
+	// half way down the arc sits at 45 degrees
+	half := radius * (1 - math.Cos(math.Pi/4))
+	if math.Abs(offsets[0][0]-half) > 1e-6 || math.Abs(offsets[0][2]+radius*math.Sin(math.Pi/4)) > 1e-6 {
+		t.Errorf("minimum curvature midpoint at %v\n", offsets[0])
+	}
+
+	// the tangent method runs straight down from the collar
+	offsets = hole.Desurvey(Tangent, []float64{100})
+	if offsets[0][0] > 1e-9 || math.Abs(offsets[0][2]+100) > 1e-9 {
+		t.Errorf("tangent ended at %v\n", offsets[0])
+	}
+
+	// balanced tangent splits the difference
+	offsets = hole.Desurvey(BalancedTangent, []float64{100})
+	if math.Abs(offsets[0][0]-50) > 1e-9 || math.Abs(offsets[0][2]+50) > 1e-9 {
+		t.Errorf("balanced tangent ended at %v\n", offsets[0])
+	}
+}
+
+func TestDrillholeTables(t *testing.T) {
+
+	var readers []*os.File
+	for _, path := range []string{collars, surveys, drillintervals} {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Errorf(err.Error())
+			return
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+
+	dataset, err := DatasetFromDrillholeTables(tableFields, readers[0], readers[1], readers[2], Options{SRS: 32612})
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	traces := make(map[string]Lines)
+	intervals := make(map[string]int)
+	for _, line := range dataset.Lines {
+		if line.StyleType == "drillhole" {
+			traces[line.Name] = line
+		} else {
+			intervals[line.Name]++
+		}
+	}
+
+	if len(traces) != 3 {
+		t.Errorf("expected 3 drillhole traces, got %d\n", len(traces))
+	}
+
+	// DH-01 has a gap, which is only a warning
+	if intervals["DH-01"] != 8 {
+		t.Errorf("DH-01 should keep all 8 intervals, got %d\n", intervals["DH-01"])
+	}
+
+	// DH-02 has an overlapping interval, DH-03 one beyond its total depth
+	if intervals["DH-02"] != 3 || intervals["DH-03"] != 2 {
+		t.Errorf("bad intervals should be dropped, DH-02 kept %d and DH-03 kept %d\n", intervals["DH-02"], intervals["DH-03"])
+	}
+
+	// DH-02 has no survey, so runs straight down
+	dh02 := traces["DH-02"].Points
+	if dh02[0][0] != dh02[len(dh02)-1][0] || dh02[0][1] != dh02[len(dh02)-1][1] || dh02[len(dh02)-1][2] != 636-80 {
+		t.Errorf("DH-02 should be vertical to 80m: %v\n", dh02)
+	}
+
+	// DH-01 curves east, it stops at its total depth
+	dh01 := traces["DH-01"].Points
+	end := dh01[len(dh01)-1]
+	if end[0] <= dh01[0][0] || end[2] > 640-100 || end[2] < 640-150 {
+		t.Errorf("DH-01 ended at %v from %v\n", end, dh01[0])
+	}
+}
+
+func TestDrillholeFeet(t *testing.T) {
+
+	// the same curving hole, logged in meters and in feet
+	trace := func(unit Unit) ([]float64, error) {
+		scale := 1 / unit.toMeter()
+		collar := fmt.Sprintf("HOLEID,EASTING,NORTHING,RL,MAXDEPTH\nDH-01,%v,%v,%v,%v\n", 392600*scale, 3769700*scale, 640*scale, 150*scale)
+		survey := fmt.Sprintf("HOLEID,DEPTH,AZIMUTH,DIP\nDH-01,0,90,-60\nDH-01,%v,95,-58\n", 50*scale)
+
+		dataset, err := DatasetFromDrillholeTables(tableFields, strings.NewReader(collar), strings.NewReader(survey), nil, Options{SRS: 32612, HorizontalUnits: unit, VerticalUnits: unit})
+		if err != nil {
+			return nil, err
+		}
+		points := dataset.Lines[0].Points
+		return points[len(points)-1], nil
+	}
+
+	meters, err := trace(Meters)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	feet, err := trace(Feet)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	// a 492 ft hole is 150m, not 492m, down and along its azimuth
+	for i := range meters {
+		if math.Abs(meters[i]-feet[i]) > 0.05 {
+			t.Errorf("the hole logged in feet ended at %v, in meters at %v\n", feet, meters)
+			break
+		}
+	}
+}
+
+func TestDrillholeMineGrid(t *testing.T) {
+
+	// a mine grid in feet on UTM 12N, its origin at 392600, 3769700
+	grid := &MineGrid{SRS: 32612, ControlPoints: []ControlPoint{
+		{LocalX: 0, LocalY: 0, X: 392600, Y: 3769700},
+		{LocalX: 1000, LocalY: 1000, X: 392600 + 304.8, Y: 3769700 + 304.8},
+	}}
+
+	// a horizontal 100 ft hole east from 100, 100
+	collar := "HOLEID,EASTING,NORTHING,RL,MAXDEPTH\nDH-01,100,100,2000,100\n"
+	survey := "HOLEID,DEPTH,AZIMUTH,DIP\nDH-01,0,90,0\n"
+
+	dataset, err := DatasetFromDrillholeTables(tableFields, strings.NewReader(collar), strings.NewReader(survey), nil, Options{MineGrid: grid, VerticalUnits: Feet, Elevation: ConstantProvider{}})
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	// resolving the options doesn't solve the caller's grid
+	if grid.Scale != 0 {
+		t.Errorf("the caller's mine grid was solved to scale %v\n", grid.Scale)
+	}
+
+	// 100 ft, not 100 m, along the grid
+	utm := Options{SRS: 32612}
+	want, _ := utm.checkCoords([]float64{392600 + 60.96, 3769700 + 30.48, 2000 * 0.3048})
+	points := dataset.Lines[0].Points
+	end := points[len(points)-1]
+	for i := range want {
+		if math.Abs(end[i]-want[i]) > 0.05 {
+			t.Errorf("the hole on a mine grid in feet ended at %v, expected %v\n", end, want)
+			break
+		}
+	}
+}
+
+func TestDrillholeDipSign(t *testing.T) {
+
+	// a surface hole drilled down, and an underground hole drilled up from a drive
+	collar := "HOLEID,EASTING,NORTHING,RL,MAXDEPTH\nSURF,392600,3769700,640,100\nUG,392700,3769700,300,50\n"
+	survey := "HOLEID,DEPTH,AZIMUTH,DIP\nSURF,0,90,-60\nUG,0,90,30\n"
+
+	ends := func(sign DipSign) (map[string]float64, error) {
+		fields := tableFields
+		fields.DipSign = sign
+		dataset, err := DatasetFromDrillholeTables(fields, strings.NewReader(collar), strings.NewReader(survey), nil, Options{SRS: 32612, Elevation: ConstantProvider{}})
+		if err != nil {
+			return nil, err
+		}
+
+		// the change in elevation from collar to end of hole
+		rise := make(map[string]float64)
+		for _, line := range dataset.Lines {
+			rise[line.Name] = line.Points[len(line.Points)-1][2] - line.Points[0][2]
+		}
+		return rise, nil
+	}
+
+	// mixed signs are read negative down, the underground hole rises
+	for _, sign := range []DipSign{AutoDip, NegativeDown} {
+		rise, err := ends(sign)
+		if err != nil {
+			t.Errorf("%q encountered %v\n", sign, err)
+			continue
+		}
+		if math.Abs(rise["SURF"]+100*math.Sin(60*deg2rad)) > 0.01 || math.Abs(rise["UG"]-50*math.Sin(30*deg2rad)) > 0.01 {
+			t.Errorf("%q: the surface hole rose %v and the underground hole %v\n", sign, rise["SURF"], rise["UG"])
+		}
+	}
+
+	// declared positive down, the other way around
+	rise, err := ends(PositiveDown)
+	if err != nil || rise["SURF"] <= 0 || rise["UG"] >= 0 {
+		t.Errorf("positivedown: the surface hole rose %v and the underground hole %v, %v\n", rise["SURF"], rise["UG"], err)
+	}
+
+	if _, err := ends("upward"); err == nil {
+		t.Errorf("an unknown dip sign should be refused\n")
+	}
+}
+
+func TestDrillholeSurveysBeyondDepth(t *testing.T) {
+
+	// every survey of DH-02 lies below its total depth, cleaning leaves it none
+	collar := "HOLEID,EASTING,NORTHING,RL,MAXDEPTH\nDH-01,392600,3769700,640,100\nDH-02,392700,3769700,640,50\n"
+	survey := "HOLEID,DEPTH,AZIMUTH,DIP\nDH-01,0,90,-60\nDH-02,60,90,-60\nDH-02,80,95,-58\n"
+
+	dataset, err := DatasetFromDrillholeTables(tableFields, strings.NewReader(collar), strings.NewReader(survey), nil, Options{SRS: 32612, Elevation: ConstantProvider{}})
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	// the hole is skipped, not desurveyed
+	if len(dataset.Lines) != 1 || dataset.Lines[0].Name != "DH-01" {
+		t.Errorf("expected only DH-01, got %d lines\n", len(dataset.Lines))
+	}
+
+	// desurveyed directly, a hole without surveys is vertical
+	hole := Drillhole{ID: "DH-03", Depth: 10}
+	offsets := hole.Desurvey(MinimumCurvature, []float64{0, 10})
+	if len(offsets) != 2 || math.Abs(offsets[1][2]+10) > 1e-9 || math.Abs(offsets[1][0]) > 1e-9 || math.Abs(offsets[1][1]) > 1e-9 {
+		t.Errorf("a hole without surveys desurveyed to %v, expected 10 straight down\n", offsets)
+	}
+}
+
+func TestDrillholeValidate(t *testing.T) {
+
+	hole := Drillhole{
+		ID:        "bad",
+		Depth:     50,
+		Surveys:   []Survey{{Depth: 60}, {Depth: 0}, {Depth: 0}},
+		Intervals: []Interval{{From: 30, To: 55}, {From: 0, To: 10}, {From: 5, To: 15}, {From: 20, To: 30}},
+	}
+
+	kinds := make(map[string]int)
+	for _, issue := range hole.Validate() {
+		kinds[issue.Kind]++
+	}
+
+	expected := map[string]int{IntervalGap: 1, IntervalOverlap: 1, IntervalBeyondDepth: 1, SurveyBeyondDepth: 1, DuplicateSurvey: 1}
+	for kind, count := range expected {
+		if kinds[kind] != count {
+			t.Errorf("expected %d %s, got %d\n", count, kind, kinds[kind])
+		}
+	}
+}
+
+func TestComposite(t *testing.T) {
+
+	hole := Drillhole{
+		ID: "composite",
+		Intervals: []Interval{
+			{From: 0, To: 1, Attributes: []Attribute{{Key: "cu", Value: "1"}, {Key: "lith", Value: "AND"}}},
+			{From: 1, To: 4, Attributes: []Attribute{{Key: "cu", Value: "2"}, {Key: "lith", Value: "QFP"}}},
+			{From: 4, To: 4.5, Attributes: []Attribute{{Key: "cu", Value: "3"}, {Key: "lith", Value: "QFP"}}},
+		},
+	}
+
+	// 2m composites, the 0.5m left at the bottom joins the composite above
+	composites := hole.Composite(Composite{Length: 2})
+	if len(composites) != 2 || composites[1].To != 4.5 {
+		t.Errorf("expected composites 0-2 and 2-4.5, got %v\n", composites)
+		return
+	}
+
+	// 1m at 1% and 1m at 2%, and a tied lithology goes to the first seen
+	if cu := attributeValue(composites[0].Attributes, "cu"); cu != "1.5" {
+		t.Errorf("0-2m composite should grade 1.5, got %s\n", cu)
+	}
+	if lith := attributeValue(composites[0].Attributes, "lith"); lith != "AND" {
+		t.Errorf("0-2m composite should be AND, got %s\n", lith)
+	}
+	if cu := attributeValue(composites[1].Attributes, "cu"); cu != "2.2" {
+		t.Errorf("2-4.5m composite should grade 2.2, got %s\n", cu)
+	}
+
+	// by lithology, no composite crosses a contact
+	composites = hole.Composite(Composite{Boundary: "lith"})
+	if len(composites) != 2 || composites[0].To != 1 || composites[1].From != 1 {
+		t.Errorf("expected composites 0-1 and 1-4.5, got %v\n", composites)
+		return
+	}
+
+	// (3*2 + 0.5*3) / 3.5
+	if cu := attributeValue(composites[1].Attributes, "cu"); cu != "2.142857" {
+		t.Errorf("1-4.5m composite should grade 2.142857, got %s\n", cu)
+	}
+}
+
+func TestDrillholeComposite(t *testing.T) {
+
+	file, err := os.Open(drillholes)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer file.Close()
+
+	fields := trekFields
+	fields.Composite = &Composite{Length: 3, Boundary: "lithology", Exclude: []string{"sampleid", "thick_m"}}
+
+	dataset, err := DatasetFromDrillholes(fields, file, Options{SRS: 3857})
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	var composites int
+	for _, line := range dataset.Lines {
+		if line.StyleType != "interval" {
+			continue
+		}
+		composites++
+
+		if attributeValue(line.Attributes, "from_m") != "" || attributeValue(line.Attributes, "sampleid") != "" {
+			t.Errorf("composite %s kept excluded attributes: %v\n", line.ID, line.Attributes)
+			return
+		}
+	}
+
+	if composites == 0 || composites > 1900 {
+		t.Errorf("expected fewer composites than samples, got %d\n", composites)
+	}
+}
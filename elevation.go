@@ -0,0 +1,233 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	srtm "github.com/amundsentech/elev-utils"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+)
+
+// ElevationProvider ... supplies ground elevations in meters for WGS84 lon lat
+// Set Options.Elevation to use a provider other than the world DEM (earthdem.vrt)
+type ElevationProvider interface {
+	// ElevationAt returns the elevation at a single lon lat
+	ElevationAt(lon float64, lat float64) (float64, error)
+
+	// ElevationsAt returns an elevation for each []float64{lon, lat}, NaN where there is none
+	ElevationsAt(lonlats [][]float64) ([]float64, error)
+}
+
+// PolygonElevationProvider ... a provider that builds its own drape of a polygon, as a point
+// cloud of []float64{lon, lat, z}.  Providers without one are sampled at their spacing.
+type PolygonElevationProvider interface {
+	ElevationProvider
+	ElevationFromPolygon(polygon [][][]float64) ([][]float64, error)
+}
+
+// errNoElevation is returned for a lon lat outside a provider's coverage
+var errNoElevation = errors.New("Z value could not be found")
+
+// VRTProvider ... the srtm tiles of a dem.vrt, as used by default
+type VRTProvider struct {
+	Dir string
+}
+
+// NewVRTProvider returns a provider for the srtm tiles of the dem.vrt at vrtPath
+func NewVRTProvider(vrtPath string) (*VRTProvider, error) {
+	if _, err := os.Stat(vrtPath); err != nil {
+		return nil, fmt.Errorf("error: digital elevation model (DEM) cannot be found at %s", vrtPath)
+	}
+
+	dir, _ := filepath.Split(vrtPath)
+	return &VRTProvider{Dir: dir}, nil
+}
+
+// ElevationAt ... see ElevationProvider
+func (p *VRTProvider) ElevationAt(lon float64, lat float64) (float64, error) {
+	// call the elevation service
+	z, err := srtm.ElevationFromLatLon(p.Dir, lat, lon)
+	if err != nil {
+		return 0.0, fmt.Errorf("[GetElev] in pkg [convert] encountered: %v", err)
+	}
+
+	// raise an error if z not found
+	if math.IsNaN(z) {
+		return 0, errNoElevation
+	}
+
+	return z, nil
+}
+
+// ElevationsAt ... see ElevationProvider
+func (p *VRTProvider) ElevationsAt(lonlats [][]float64) ([]float64, error) {
+	return elevationsAt(p, lonlats)
+}
+
+// ElevationFromPolygon ... see PolygonElevationProvider
+func (p *VRTProvider) ElevationFromPolygon(polygon [][][]float64) ([][]float64, error) {
+	return srtm.ElevationFromPolygon(p.Dir, polygon)
+}
+
+// ConstantProvider ... the same elevation everywhere, eg 0 to convert without any DEM
+type ConstantProvider struct {
+	Z float64
+}
+
+// ElevationAt ... see ElevationProvider
+func (p ConstantProvider) ElevationAt(lon float64, lat float64) (float64, error) {
+	return p.Z, nil
+}
+
+// ElevationsAt ... see ElevationProvider
+func (p ConstantProvider) ElevationsAt(lonlats [][]float64) ([]float64, error) {
+	return elevationsAt(p, lonlats)
+}
+
+// elevationsAt is ElevationsAt for providers without a faster batch lookup
+func elevationsAt(p ElevationProvider, lonlats [][]float64) ([]float64, error) {
+	zs := make([]float64, len(lonlats))
+	for i, lonlat := range lonlats {
+		if len(lonlat) < 2 {
+			return nil, errors.New("missing lon, lat")
+		}
+
+		z, err := p.ElevationAt(lonlat[0], lonlat[1])
+		if err != nil {
+			z = math.NaN()
+		}
+		zs[i] = z
+	}
+	return zs, nil
+}
+
+// worldDEM caches the world DEM across conversions
+var worldDEM *CachedProvider
+var worldDEMLock sync.Mutex
+
+// defaultElevation is the world DEM, resolved from DemVrtPath and cached
+func defaultElevation() (ElevationProvider, error) {
+	if _, err := DemVrtPath(); err != nil {
+		return nil, err
+	}
+
+	worldDEMLock.Lock()
+	defer worldDEMLock.Unlock()
+
+	if worldDEM == nil || worldDEM.Provider.(*VRTProvider).Dir != demdir {
+		worldDEM = NewCachedProvider(&VRTProvider{Dir: demdir}, defaultCacheTiles)
+	}
+	return worldDEM, nil
+}
+
+// elevation returns the declared provider, or the world DEM, read with the declared interpolation
+func (o *Options) elevation() (ElevationProvider, error) {
+	provider := o.Elevation
+	if provider == nil {
+		var err error
+		if provider, err = defaultElevation(); err != nil {
+			return nil, err
+		}
+	}
+	return Interpolated(provider, o.Interpolation), nil
+}
+
+// elevationAt gets the elevation for the given EPSG:4326 lon lat from the declared provider
+func (o *Options) elevationAt(lon float64, lat float64) (float64, error) {
+	provider, err := o.elevation()
+	if err != nil {
+		return math.NaN(), err
+	}
+	return provider.ElevationAt(lon, lat)
+}
+
+// elevationFromPolygon builds a 3D point cloud of an EPSG:4326 polygon, for the drape
+func (o *Options) elevationFromPolygon(polygon [][][]float64) ([][]float64, error) {
+	provider, err := o.elevation()
+	if err != nil {
+		return nil, err
+	}
+
+	if p, ok := provider.(PolygonElevationProvider); ok {
+		return p.ElevationFromPolygon(polygon)
+	}
+
+	return polygonCloud(provider, polygon)
+}
+
+// gridSpacing is implemented by providers with a natural sample spacing, in degrees
+type gridSpacing interface {
+	spacing() float64
+}
+
+const (
+	// one arc second, the spacing of srtm
+	arcSecond = 1.0 / 3600
+
+	// the most points sampled within a polygon
+	maxCloudPoints = 250000
+)
+
+// polygonCloud samples a provider within an EPSG:4326 polygon, holes excluded,
+// on a lon lat grid at the provider's spacing, plus every vertex of the polygon
+func polygonCloud(provider ElevationProvider, polygon [][][]float64) ([][]float64, error) {
+	if len(polygon) == 0 || len(polygon[0]) < 3 {
+		return nil, errors.New("polygon has no outer ring")
+	}
+
+	var poly orb.Polygon
+	var lonlats [][]float64
+	lx, ly, rx, uy := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, ring := range polygon {
+		var r orb.Ring
+		for _, coord := range ring {
+			r = append(r, orb.Point{coord[0], coord[1]})
+			lx, ly = math.Min(lx, coord[0]), math.Min(ly, coord[1])
+			rx, uy = math.Max(rx, coord[0]), math.Max(uy, coord[1])
+			lonlats = append(lonlats, []float64{coord[0], coord[1]})
+		}
+		poly = append(poly, r)
+	}
+
+	spacing := arcSecond
+	if p, ok := provider.(gridSpacing); ok {
+		spacing = p.spacing()
+	}
+
+	// large polygons are sampled more coarsely
+	if n := ((rx - lx) / spacing) * ((uy - ly) / spacing); n > maxCloudPoints {
+		spacing *= math.Sqrt(n / maxCloudPoints)
+	}
+
+	for lat := ly + spacing/2; lat < uy; lat += spacing {
+		for lon := lx + spacing/2; lon < rx; lon += spacing {
+			if planar.PolygonContains(poly, orb.Point{lon, lat}) {
+				lonlats = append(lonlats, []float64{lon, lat})
+			}
+		}
+	}
+
+	zs, err := provider.ElevationsAt(lonlats)
+	if err != nil {
+		return nil, err
+	}
+
+	var cloud [][]float64
+	for i, lonlat := range lonlats {
+		if math.IsNaN(zs[i]) {
+			continue
+		}
+		cloud = append(cloud, []float64{lonlat[0], lonlat[1], zs[i]})
+	}
+
+	if len(cloud) < 3 {
+		return nil, errors.New("no elevations found within the polygon")
+	}
+
+	return cloud, nil
+}
@@ -0,0 +1,533 @@
+package convert
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+const (
+	//elevation testing datasets
+	demUTM   = "tests/dem/testshape_utm.tif"
+	dem4326  = "tests/dem/testshape_4326.tif"
+	demLidar = "tests/dem/testshape_lidar.asc"
+)
+
+func readGrid(t *testing.T, path string) *Grid {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Errorf(err.Error())
+		return nil
+	}
+	defer file.Close()
+
+	grid, err := ReadGeoTIFF(file)
+	if err != nil {
+		t.Errorf("%s: %v\n", path, err.Error())
+		return nil
+	}
+	return grid
+}
+
+func TestReadGeoTIFF(t *testing.T) {
+
+	// utm 12N, float32, deflate with the floating point predictor, in strips
+	grid := readGrid(t, demUTM)
+	if grid == nil {
+		return
+	}
+
+	if grid.CRS == nil || grid.CRS.EPSG != 32612 || grid.Cols != 60 || grid.X0 != 392000 || grid.Y0 != 3770500 {
+		t.Errorf("utm geotiff read as %d x %d from %v, %v in %v\n", grid.Cols, grid.Rows, grid.X0, grid.Y0, grid.CRS)
+	}
+
+	// the center of column 10, row 20
+	lon, lat := grid.CRS.ToLonLat(392000+10.5*30, 3770500-20.5*30)
+	z, err := grid.ElevationAt(lon, lat)
+	if err != nil || math.Abs(z-(600+10.5*30*0.05+20.5*30*0.02)) > 1e-3 {
+		t.Errorf("utm geotiff elevation %v, %v\n", z, err)
+	}
+
+	// the corner cell is nodata
+	lon, lat = grid.CRS.ToLonLat(392000+15, 3770500-15)
+	if _, err := grid.ElevationAt(lon, lat); err == nil {
+		t.Errorf("utm geotiff nodata should have no elevation\n")
+	}
+
+	// wgs84, int16, big endian, lzw with the horizontal predictor, in tiles, pixel is point
+	grid = readGrid(t, dem4326)
+	if grid == nil {
+		return
+	}
+
+	for _, cell := range [][2]int{{0, 0}, {17, 5}, {40, 63}, {63, 33}} {
+		z, err := grid.ElevationAt(-112.18+(float64(cell[0])+0.5)*0.0005, 34.08-(float64(cell[1])+0.5)*0.0005)
+		if err != nil || z != float64(500+cell[0]+2*cell[1]) {
+			t.Errorf("4326 geotiff cell %v elevation %v, %v\n", cell, z, err)
+		}
+	}
+
+	// outside the grid
+	if _, err := grid.ElevationAt(-112, 34); err == nil {
+		t.Errorf("4326 geotiff should have no elevation outside its extent\n")
+	}
+}
+
+func TestElevationProvider(t *testing.T) {
+
+	// without the world dem, a provider is required
+	cached, env := demvrt, os.Getenv(envDEMVRT)
+	demvrt = ""
+	os.Setenv(envDEMVRT, "/nonexistent/earthdem.vrt")
+	defer func() {
+		demvrt = cached
+		os.Setenv(envDEMVRT, env)
+	}()
+
+	file, err := os.Open(pointsnoZ)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer file.Close()
+
+	if _, err := DatasetFromCSV("X", "Y", "", file, Options{SRS: 3857}); err == nil {
+		t.Errorf("conversion without a dem or provider should fail\n")
+	}
+
+	file.Seek(0, 0)
+	dataset, err := DatasetFromCSV("X", "Y", "", file, Options{SRS: 3857, Elevation: ConstantProvider{Z: 1234}})
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	for _, point := range dataset.Points {
+		if point.Points[2] != 1234 {
+			t.Errorf("point %s took z %v from the constant provider\n", point.ID, point.Points[2])
+			break
+		}
+	}
+
+	if dataset.Center[0].Z != 1234 {
+		t.Errorf("center took z %v from the constant provider\n", dataset.Center[0].Z)
+	}
+}
+
+func TestGridDrape(t *testing.T) {
+
+	grid := readGrid(t, dem4326)
+	if grid == nil {
+		return
+	}
+
+	file, err := os.Open(singleshape)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer file.Close()
+
+	// a 2D polygon is draped over the grid as a mesh
+	dataset, err := DatasetFromGEOJSON("", "", "", file, Options{SRS: 4326, Elevation: grid})
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	if len(dataset.Shapes) != 1 || len(dataset.Shapes[0].Vertices) < 3 || len(dataset.Shapes[0].Indices) == 0 {
+		t.Errorf("polygon was not draped over the grid\n")
+		return
+	}
+
+	for _, vertex := range dataset.Shapes[0].Vertices {
+		if vertex[2] < 500 || vertex[2] > 500+63+2*63 {
+			t.Errorf("drape vertex %v is not on the grid\n", vertex)
+			break
+		}
+	}
+}
+
+func TestLocalDEM(t *testing.T) {
+
+	file, err := os.Open(demLidar)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer file.Close()
+
+	options, err := resolveOptions([]Options{{SRS: 32612, LocalDEM: file, LocalDEMSRS: 32612, Elevation: ConstantProvider{Z: 1}}})
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	// within the lidar, column 16 row 4 from the top
+	coord, err := options.checkCoords([]float64{392665, 3769757})
+	if err != nil || math.Abs(coord[2]-1016.4) > 1e-9 {
+		t.Errorf("z within the local dem was %v, %v\n", coord, err)
+	}
+
+	// outside it, and in its nodata cell, the declared provider is used
+	for _, xy := range [][]float64{{392000, 3769757}, {392505, 3769605}} {
+		coord, err = options.checkCoords(xy)
+		if err != nil || coord[2] != 1 {
+			t.Errorf("z outside the local dem at %v was %v, %v\n", xy, coord, err)
+		}
+	}
+
+	// a batch mixes the two
+	zs, _ := options.Elevation.ElevationsAt([][]float64{{-112.1631, 34.0631}, {-113, 35}})
+	if math.Abs(zs[0]-1016.4) > 1 || zs[1] != 1 {
+		t.Errorf("batch elevations through the fallback were %v\n", zs)
+	}
+
+	// the reader is spent, Options reused with it are refused rather than read as an empty grid
+	reused := Options{SRS: 32612, LocalDEM: file, LocalDEMSRS: 32612, Elevation: ConstantProvider{Z: 1}}
+	if _, err := resolveOptions([]Options{reused}); err == nil || !strings.Contains(err.Error(), "read once") {
+		t.Errorf("a spent local dem reader encountered %v, expected it to be refused\n", err)
+	}
+
+	// an ascii grid needs its srs declared
+	file.Seek(0, 0)
+	if _, err := ReadDEM(file, 0); err == nil {
+		t.Errorf("an ascii grid without an srs should be refused\n")
+	}
+}
+
+// countingProvider counts the lookups reaching it
+type countingProvider struct {
+	lookups int
+}
+
+func (p *countingProvider) ElevationAt(lon float64, lat float64) (float64, error) {
+	p.lookups++
+	if lon > 0 {
+		return 0, errNoElevation
+	}
+	return lon + lat, nil
+}
+
+func (p *countingProvider) ElevationsAt(lonlats [][]float64) ([]float64, error) {
+	return elevationsAt(p, lonlats)
+}
+
+func TestCachedProvider(t *testing.T) {
+
+	counting := &countingProvider{}
+	cache := NewCachedProvider(counting, 2)
+
+	// points within the same arc second share a lookup, at the cell center
+	z1, _ := cache.ElevationAt(-112.5, 34.5)
+	z2, _ := cache.ElevationAt(-112.5+arcSecond/4, 34.5)
+	if counting.lookups != 1 || z1 != z2 || z1 != -78 {
+		t.Errorf("expected 1 lookup of -78, got %d lookups of %v, %v\n", counting.lookups, z1, z2)
+	}
+
+	// a batch only asks for the cells it doesn't have, once each
+	zs, _ := cache.ElevationsAt([][]float64{{-112.5, 34.5}, {-112.25, 34.25}, {-112.25, 34.25}, {1.5, 1.5}})
+	if counting.lookups != 3 || zs[1] != -78 || !math.IsNaN(zs[3]) {
+		t.Errorf("expected 3 lookups, got %d for %v\n", counting.lookups, zs)
+	}
+
+	// a cell without elevation is remembered too
+	if _, err := cache.ElevationAt(1.5, 1.5); err == nil || counting.lookups != 3 {
+		t.Errorf("a cached cell without elevation should not be asked for again\n")
+	}
+
+	// a third tile evicts the least recently used, -113 34
+	cache.ElevationAt(-100.5, 40.5)
+	cache.ElevationAt(-112.5, 34.5)
+	if counting.lookups != 5 {
+		t.Errorf("expected the evicted tile to be looked up again, %d lookups\n", counting.lookups)
+	}
+
+	if hits, misses := cache.Stats(); hits != 3 || misses != 6 {
+		t.Errorf("expected 3 hits and 6 misses, got %d and %d\n", hits, misses)
+	}
+}
+
+// benchmarkElevation converts a dataset with the world DEM, uncached and cached.  Every vertex is
+// clamped to the ground, so each is looked up whether or not the dataset has a Z.
+func benchmarkElevation(b *testing.B, path string, convert func(io.Reader, ...Options) (*Datasets, error)) {
+	if _, err := DemVrtPath(); err != nil {
+		b.Skip(err.Error())
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// more than the center point must reach the dem, or there's nothing to compare
+	counting := &countingProvider{}
+	convert(bytes.NewReader(raw), Options{GuessSRS: true, Elevation: counting, AltitudeMode: ClampToGround})
+	if counting.lookups <= 1 {
+		b.Fatalf("%s made %d dem lookups, expected one per vertex", path, counting.lookups)
+	}
+
+	vrt := &VRTProvider{Dir: demdir}
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			convert(bytes.NewReader(raw), Options{GuessSRS: true, Elevation: vrt, AltitudeMode: ClampToGround})
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			convert(bytes.NewReader(raw), Options{GuessSRS: true, Elevation: NewCachedProvider(vrt, defaultCacheTiles), AltitudeMode: ClampToGround})
+		}
+	})
+}
+
+func BenchmarkElevationGPX(b *testing.B) {
+	benchmarkElevation(b, linesgpx, func(contents io.Reader, opts ...Options) (*Datasets, error) {
+		return DatasetFromGPX("", "", "", contents, opts...)
+	})
+}
+
+func BenchmarkElevationKML(b *testing.B) {
+	benchmarkElevation(b, pointskml, func(contents io.Reader, opts ...Options) (*Datasets, error) {
+		return DatasetFromKML("", "", "", contents, opts...)
+	})
+}
+
+// planeProvider is a tilted plane, 1m per arc second east and 2m per arc second north
+type planeProvider struct{}
+
+func (planeProvider) ElevationAt(lon float64, lat float64) (float64, error) {
+	return (lon + 2*lat) / arcSecond, nil
+}
+
+func (p planeProvider) ElevationsAt(lonlats [][]float64) ([]float64, error) {
+	return elevationsAt(p, lonlats)
+}
+
+func TestInterpolation(t *testing.T) {
+
+	grid := readGrid(t, dem4326)
+	if grid == nil {
+		return
+	}
+
+	// the grid is 500 + col + 2*row, a quarter cell west and a tenth of a cell south of a center
+	lon, lat := -112.18+10.25*0.0005, 34.08-20.6*0.0005
+	expected := map[Interpolation]float64{Nearest: 550, Bilinear: 549.95, Bicubic: 549.95}
+	for mode, want := range expected {
+		z, err := Interpolated(grid, mode).ElevationAt(lon, lat)
+		if err != nil || math.Abs(z-want) > 1e-9 {
+			t.Errorf("%s grid elevation %v, %v expected %v\n", mode, z, err, want)
+		}
+	}
+
+	// providers without cells are read on the arc second lattice
+	lon, lat = -112.5+0.3*arcSecond, 34.5+0.6*arcSecond
+	plane, _ := planeProvider{}.ElevationAt(lon, lat)
+	for _, mode := range []Interpolation{Bilinear, Bicubic} {
+		z, err := Interpolated(planeProvider{}, mode).ElevationAt(lon, lat)
+		if err != nil || math.Abs(z-plane) > 1e-6 {
+			t.Errorf("%s lattice elevation %v, %v expected %v\n", mode, z, err, plane)
+		}
+	}
+
+	// the option applies to z filling
+	options, err := resolveOptions([]Options{{SRS: 4326, Elevation: grid, Interpolation: Bilinear}})
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	coord, _ := options.checkCoords([]float64{-112.18 + 10.25*0.0005, 34.08 - 20.6*0.0005})
+	if math.Abs(coord[2]-549.95) > 1e-9 {
+		t.Errorf("bilinear z fill was %v\n", coord[2])
+	}
+
+	if _, err := resolveOptions([]Options{{SRS: 4326, Interpolation: "cubic"}}); err == nil {
+		t.Errorf("an unknown interpolation should be refused\n")
+	}
+}
+
+func TestDrape(t *testing.T) {
+
+	grid := readGrid(t, dem4326)
+	if grid == nil {
+		return
+	}
+
+	// about 1.8km east west across the grid
+	line := [][]float64{{-112.175, 34.07}, {-112.155, 34.07}}
+
+	options, _ := resolveOptions([]Options{{SRS: 4326, Elevation: grid}})
+	parsed, _ := options.checkCoordsBatch(line)
+	if len(parsed) != 2 {
+		t.Errorf("without drape the line should keep its 2 vertices, got %d\n", len(parsed))
+	}
+
+	options, _ = resolveOptions([]Options{{SRS: 4326, Elevation: grid, Drape: true, DrapeSpacing: 50}})
+	parsed, _ = options.checkCoordsBatch(line)
+	if len(parsed) < 35 || len(parsed) > 40 {
+		t.Errorf("a 1.8km line draped every 50m should have about 37 vertices, got %d\n", len(parsed))
+	}
+
+	// each vertex sits on the grid
+	for _, vertex := range parsed {
+		z, _ := grid.ElevationAt(webMercatorTo4326(vertex[0], vertex[1]))
+		if vertex[2] != z {
+			t.Errorf("draped vertex %v is not on the grid at %v\n", vertex, z)
+			break
+		}
+	}
+
+	// the ends are untouched
+	first, _ := options.checkCoords(line[0])
+	if parsed[0][0] != first[0] || parsed[0][1] != first[1] {
+		t.Errorf("draped line moved its first vertex to %v\n", parsed[0])
+	}
+
+	// by default, at the cell size of the grid, about 56m
+	options, _ = resolveOptions([]Options{{SRS: 4326, Elevation: grid, Drape: true}})
+	if spacing := options.drapeSpacing(grid); math.Abs(spacing-55.66) > 0.01 {
+		t.Errorf("default drape spacing was %v\n", spacing)
+	}
+
+	// a line with z is left alone
+	parsed, _ = options.checkCoordsBatch([][]float64{{-112.175, 34.07, 10}, {-112.155, 34.07, 10}})
+	if len(parsed) != 2 {
+		t.Errorf("a line with z should not be draped\n")
+	}
+
+	// a gpx route without ele is draped by default
+	gpx := `<gpx version="1.1"><rte><rtept lat="34.07" lon="-112.175"></rtept><rtept lat="34.07" lon="-112.155"></rtept></rte></gpx>`
+	results, err := DatasetFromGPX("", "", "", strings.NewReader(gpx), Options{Elevation: grid, Drape: true, DrapeSpacing: 50})
+	if err != nil {
+		t.Errorf("gpx drape encountered %v\n", err)
+		return
+	}
+
+	route := results.Lines[0].Points
+	if len(route) < 35 || len(route) > 40 {
+		t.Errorf("a 1.8km gpx route draped every 50m should have about 37 vertices, got %d\n", len(route))
+	}
+	for _, vertex := range route {
+		z, _ := grid.ElevationAt(webMercatorTo4326(vertex[0], vertex[1]))
+		if vertex[2] != z {
+			t.Errorf("draped gpx vertex %v is not on the grid at %v\n", vertex, z)
+			break
+		}
+	}
+}
+
+func TestAltitudeMode(t *testing.T) {
+
+	ground := ConstantProvider{Z: 100}
+
+	tests := []struct {
+		mode     AltitudeMode
+		offset   float64
+		withZ    float64
+		withoutZ float64
+	}{
+		{"", 0, 10, 100},
+		{Absolute, 5, 15, 105},
+		{RelativeToGround, 0, 110, 100},
+		{RelativeToGround, 2, 112, 102},
+		{ClampToGround, 0, 100, 100},
+		{ClampToGround, -1, 99, 99},
+	}
+
+	for _, test := range tests {
+		options, err := resolveOptions([]Options{{SRS: 4326, Elevation: ground, AltitudeMode: test.mode, ZOffset: test.offset}})
+		if err != nil {
+			t.Errorf("%q altitude mode encountered %v\n", test.mode, err)
+			continue
+		}
+
+		// points, and lines mixing coordinates with and without z
+		point, _ := options.checkCoords([]float64{-112.17, 34.07, 10})
+		line, _ := options.checkCoordsBatch([][]float64{{-112.17, 34.07, 10}, {-112.16, 34.07}})
+		if point[2] != test.withZ || line[0][2] != test.withZ || line[1][2] != test.withoutZ {
+			t.Errorf("%q altitude mode offset %v gave %v and %v, expected %v and %v\n", test.mode, test.offset, point[2], line, test.withZ, test.withoutZ)
+		}
+
+		// a drillhole collar too
+		if z, _ := options.collarElevation([]float64{-112.17, 34.07, 10}); z != test.withZ {
+			t.Errorf("%q altitude mode placed the collar at %v, expected %v\n", test.mode, z, test.withZ)
+		}
+	}
+
+	if _, err := resolveOptions([]Options{{SRS: 4326, Elevation: ground, AltitudeMode: "onTheSeaFloor"}}); err == nil {
+		t.Errorf("an unknown altitude mode should be refused\n")
+	}
+
+	// a trace hangs from its collar, and isn't lifted again
+	options, _ := resolveOptions([]Options{{SRS: 4326, Elevation: ground, AltitudeMode: RelativeToGround}})
+	hole := &Drillhole{ID: "DH1", Collar: []float64{-112.17, 34.07, 1}, Depth: 10, Surveys: []Survey{{Depth: 0, Azimuth: 0, Dip: 90}}}
+	container := &ExtentContainer{opts: options, ch: make(chan []float64, 2)}
+	trace, err := hole.trace(MinimumCurvature, []float64{0, 10}, container)
+	if err != nil || len(trace) != 2 || trace[0][2] != 101 || math.Abs(trace[1][2]-91) > 1e-6 {
+		t.Errorf("relative drillhole trace was %v, %v expected 101 down to 91\n", trace, err)
+	}
+}
+
+func TestGeoid(t *testing.T) {
+
+	geoidfile := "tests/geoid/egm96_sample.grd"
+
+	geoid, err := LoadGeoid(geoidfile)
+	if err != nil {
+		t.Errorf("geoid %s encountered %v\n", geoidfile, err)
+		return
+	}
+
+	// the sample is -30 + 1m per degree east of 247, and 2m per degree north of 33, in 0 to 360 lon
+	lon, lat := -112.17, 34.07
+	expected := -30 + (lon + 360 - 247) + 2*(lat-33)
+	if n, err := geoid.Undulation(lon, lat); err != nil || math.Abs(n-expected) > 1e-6 {
+		t.Errorf("undulation at %v, %v was %v, %v expected %v\n", lon, lat, n, err, expected)
+	}
+
+	if _, err := geoid.Undulation(10, 50); err == nil {
+		t.Errorf("undulation outside the sample should error\n")
+	}
+
+	ground := ConstantProvider{Z: 100}
+
+	// an ellipsoidal gps height is taken down to the orthometric dem
+	options, err := resolveOptions([]Options{{SRS: 4326, Elevation: ground, ZDatum: Ellipsoidal, GeoidPath: geoidfile}})
+	if err != nil {
+		t.Errorf("ellipsoidal options encountered %v\n", err)
+		return
+	}
+	line, _ := options.checkCoordsBatch([][]float64{{lon, lat, 100 + expected}, {lon, lat}})
+	if math.Abs(line[0][2]-100) > 1e-6 || line[1][2] != 100 {
+		t.Errorf("ellipsoidal heights converted to %v, expected 100\n", line)
+	}
+
+	// and the dem taken up to an ellipsoidal output
+	options, _ = resolveOptions([]Options{{SRS: 4326, Elevation: ground, OutputZDatum: Ellipsoidal, GeoidPath: geoidfile}})
+	line, _ = options.checkCoordsBatch([][]float64{{lon, lat, 100}, {lon, lat}})
+	if math.Abs(line[0][2]-(100+expected)) > 1e-6 || math.Abs(line[1][2]-(100+expected)) > 1e-6 {
+		t.Errorf("orthometric heights converted to %v, expected %v\n", line, 100+expected)
+	}
+
+	// heights above ground have no datum
+	options, _ = resolveOptions([]Options{{SRS: 4326, Elevation: ground, AltitudeMode: RelativeToGround, ZDatum: Ellipsoidal, Geoid: geoid}})
+	if point, _ := options.checkCoords([]float64{lon, lat, 10}); point[2] != 110 {
+		t.Errorf("relative height with an ellipsoidal datum was %v, expected 110\n", point[2])
+	}
+
+	// beyond the geoid the height can't be converted, rather than being left off by the undulation
+	options, _ = resolveOptions([]Options{{SRS: 4326, Elevation: ground, ZDatum: Ellipsoidal, Geoid: geoid}})
+	if _, err := options.checkCoordsBatch([][]float64{{10, 50, 100}}); err == nil {
+		t.Errorf("an ellipsoidal height outside the geoid should be refused\n")
+	}
+
+	if _, err := resolveOptions([]Options{{SRS: 4326, Elevation: ground, ZDatum: Ellipsoidal}}); err == nil {
+		t.Errorf("an ellipsoidal datum without a geoid should be refused\n")
+	}
+}
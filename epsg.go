@@ -0,0 +1,191 @@
+package convert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The registry below holds the EPSG codes convert knows how to reproject
+// It is deliberately small, covering what mine and exploration data arrives in:
+// UTM on the common datums, some state plane, and the national albers,
+// lambert and polar stereographic systems.  Add codes here as needed.
+
+// ellipsoids
+var (
+	wgs84     = Ellipsoid{Name: "WGS 84", A: 6378137, InvF: 298.257223563}
+	grs80     = Ellipsoid{Name: "GRS 1980", A: 6378137, InvF: 298.257222101}
+	clarke66  = Ellipsoid{Name: "Clarke 1866", A: 6378206.4, InvF: 294.978698213898}
+	intl1924  = Ellipsoid{Name: "International 1924", A: 6378388, InvF: 297}
+	australia = Ellipsoid{Name: "Australian National Spheroid", A: 6378160, InvF: 298.25}
+	airy1830  = Ellipsoid{Name: "Airy 1830", A: 6377563.396, InvF: 299.3249646}
+)
+
+// datums, with their +towgs84 helmert parameters
+var (
+	datumWGS84     = Datum{Name: "WGS 84", Ellipsoid: wgs84}
+	datumNAD83     = Datum{Name: "NAD83", Ellipsoid: grs80}
+	datumNAD83CSRS = Datum{Name: "NAD83(CSRS)", Ellipsoid: grs80}
+	datumNAD27     = Datum{Name: "NAD27", Ellipsoid: clarke66, ToWGS84: [7]float64{-8, 160, 176}}
+	datumGDA94     = Datum{Name: "GDA94", Ellipsoid: grs80}
+	datumGDA2020   = Datum{Name: "GDA2020", Ellipsoid: grs80}
+	datumAGD66     = Datum{Name: "AGD66", Ellipsoid: australia, ToWGS84: [7]float64{-117.808, -51.681, 137.784, 0.303, 0.446, 0.234, -0.29}}
+	datumAGD84     = Datum{Name: "AGD84", Ellipsoid: australia, ToWGS84: [7]float64{-117.763, -51.51, 139.061, 0.292, 0.443, 0.277, -0.191}}
+	datumETRS89    = Datum{Name: "ETRS89", Ellipsoid: grs80}
+	datumED50      = Datum{Name: "ED50", Ellipsoid: intl1924, ToWGS84: [7]float64{-87, -98, -121}}
+	datumOSGB36    = Datum{Name: "OSGB36", Ellipsoid: airy1830, ToWGS84: [7]float64{446.448, -125.157, 542.06, 0.15, 0.247, 0.842, -20.489}}
+	datumNZGD2000  = Datum{Name: "NZGD2000", Ellipsoid: grs80}
+	datumRGF93     = Datum{Name: "RGF93", Ellipsoid: grs80}
+)
+
+// registry holds every known crs by EPSG code, built once at init
+var registry = make(map[int]*CRS)
+
+// LookupEPSG returns the crs for an EPSG code, or an error if convert doesn't know it
+func LookupEPSG(code int) (*CRS, error) {
+	crs, ok := registry[code]
+	if !ok {
+		return nil, fmt.Errorf("unsupported srs EPSG:%d", code)
+	}
+	return crs, nil
+}
+
+// LookupCRSName returns the crs for a named crs as found in geojson, gml, or postgis
+// eg "EPSG:26911", "urn:ogc:def:crs:EPSG::26911", "http://www.opengis.net/def/crs/EPSG/0/26911"
+// and "urn:ogc:def:crs:OGC:1.3:CRS84", which is EPSG:4326 in lon lat order
+func LookupCRSName(name string) (*CRS, error) {
+	lower := strings.ToLower(strings.TrimSpace(name))
+
+	if strings.HasSuffix(lower, "crs84") {
+		return LookupEPSG(4326)
+	}
+
+	if !strings.Contains(lower, "epsg") && !strings.Contains(lower, "esri") {
+		return nil, fmt.Errorf("unsupported crs name %s", name)
+	}
+
+	// the code is always the last segment of the name
+	segments := strings.FieldsFunc(lower, func(r rune) bool { return r == ':' || r == '/' })
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("unsupported crs name %s", name)
+	}
+
+	code, err := strconv.Atoi(segments[len(segments)-1])
+	if err != nil {
+		return nil, fmt.Errorf("unsupported crs name %s", name)
+	}
+
+	return LookupEPSG(code)
+}
+
+// register adds a crs to the registry
+func register(code int, name string, datum Datum, projection Projection, toMeter float64) {
+	registry[code] = &CRS{EPSG: code, Name: name, Datum: datum, Projection: projection, ToMeter: toMeter}
+}
+
+// registerUTM adds a run of UTM zones, code for the first zone onward
+func registerUTM(code int, datum Datum, firstZone int, lastZone int, south bool) {
+	for zone := firstZone; zone <= lastZone; zone++ {
+		hemisphere, fn := "N", 0.0
+		if south {
+			hemisphere, fn = "S", 10000000
+		}
+
+		tm := transverseMercator{e: datum.Ellipsoid, lon0: float64(zone*6 - 183), k0: 0.9996, fe: 500000, fn: fn}
+		name := fmt.Sprintf("%s / UTM zone %d%s", datum.Name, zone, hemisphere)
+
+		register(code+zone-firstZone, name, datum, tm, 1)
+	}
+}
+
+func init() {
+	// geographic
+	register(4326, "WGS 84", datumWGS84, nil, 1)
+	register(4269, "NAD83", datumNAD83, nil, 1)
+	register(4617, "NAD83(CSRS)", datumNAD83CSRS, nil, 1)
+	register(4267, "NAD27", datumNAD27, nil, 1)
+	register(4283, "GDA94", datumGDA94, nil, 1)
+	register(7844, "GDA2020", datumGDA2020, nil, 1)
+	register(4202, "AGD66", datumAGD66, nil, 1)
+	register(4203, "AGD84", datumAGD84, nil, 1)
+	register(4258, "ETRS89", datumETRS89, nil, 1)
+	register(4230, "ED50", datumED50, nil, 1)
+	register(4277, "OSGB36", datumOSGB36, nil, 1)
+	register(4167, "NZGD2000", datumNZGD2000, nil, 1)
+	register(4171, "RGF93", datumRGF93, nil, 1)
+
+	// web mercator, its deprecated / esri aliases all resolve to the one crs
+	register(3857, "WGS 84 / Pseudo-Mercator", datumWGS84, webMercator{}, 1)
+	for _, code := range []int{3785, 900913, 102100, 102113} {
+		registry[code] = registry[3857]
+	}
+
+	// utm
+	registerUTM(32601, datumWGS84, 1, 60, false)
+	registerUTM(32701, datumWGS84, 1, 60, true)
+	registerUTM(26901, datumNAD83, 1, 23, false)
+	registerUTM(26703, datumNAD27, 3, 22, false)
+	registerUTM(3154, datumNAD83CSRS, 7, 10, false)
+	registerUTM(2955, datumNAD83CSRS, 11, 13, false)
+	registerUTM(3158, datumNAD83CSRS, 14, 16, false)
+	registerUTM(2958, datumNAD83CSRS, 17, 21, false)
+	registerUTM(28348, datumGDA94, 48, 58, true)
+	registerUTM(7846, datumGDA2020, 46, 59, true)
+	registerUTM(20248, datumAGD66, 48, 58, true)
+	registerUTM(20348, datumAGD84, 48, 58, true)
+	registerUTM(25828, datumETRS89, 28, 38, false)
+	registerUTM(23028, datumED50, 28, 38, false)
+
+	// universal polar stereographic
+	register(32661, "WGS 84 / UPS North (N,E)", datumWGS84, polarStereographic{e: wgs84, k0: 0.994, fe: 2000000, fn: 2000000}, 1)
+	register(32761, "WGS 84 / UPS South (N,E)", datumWGS84, polarStereographic{e: wgs84, south: true, k0: 0.994, fe: 2000000, fn: 2000000}, 1)
+
+	// polar stereographic
+	register(3413, "WGS 84 / NSIDC Sea Ice Polar Stereographic North", datumWGS84, polarStereographic{e: wgs84, latTs: 70, lon0: -45}, 1)
+	register(3995, "WGS 84 / Arctic Polar Stereographic", datumWGS84, polarStereographic{e: wgs84, latTs: 71}, 1)
+	register(3031, "WGS 84 / Antarctic Polar Stereographic", datumWGS84, polarStereographic{e: wgs84, south: true, latTs: -71}, 1)
+
+	// albers equal area
+	register(5070, "NAD83 / Conus Albers", datumNAD83, albersEqualArea{e: grs80, lat1: 29.5, lat2: 45.5, lat0: 23, lon0: -96}, 1)
+	register(3338, "NAD83 / Alaska Albers", datumNAD83, albersEqualArea{e: grs80, lat1: 55, lat2: 65, lat0: 50, lon0: -154}, 1)
+	register(3005, "NAD83 / BC Albers", datumNAD83, albersEqualArea{e: grs80, lat1: 50, lat2: 58.5, lat0: 45, lon0: -126, fe: 1000000}, 1)
+	register(3578, "NAD83 / Yukon Albers", datumNAD83, albersEqualArea{e: grs80, lat1: 61.66666666666666, lat2: 68, lat0: 59, lon0: -132.5, fe: 500000, fn: 500000}, 1)
+	register(3577, "GDA94 / Australian Albers", datumGDA94, albersEqualArea{e: grs80, lat1: -18, lat2: -36, lon0: 132}, 1)
+
+	// lambert conformal conic
+	register(3347, "NAD83 / Statistics Canada Lambert", datumNAD83, lambertConformalConic{e: grs80, lat1: 49, lat2: 77, lat0: 63.390675, lon0: -91.86666666666666, fe: 6200000, fn: 3000000}, 1)
+	register(3978, "NAD83 / Canada Atlas Lambert", datumNAD83, lambertConformalConic{e: grs80, lat1: 49, lat2: 77, lat0: 49, lon0: -95}, 1)
+	register(3112, "GDA94 / Geoscience Australia Lambert", datumGDA94, lambertConformalConic{e: grs80, lat1: -18, lat2: -36, lon0: 134}, 1)
+	register(2154, "RGF93 / Lambert-93", datumRGF93, lambertConformalConic{e: grs80, lat1: 49, lat2: 44, lat0: 46.5, lon0: 3, fe: 700000, fn: 6600000}, 1)
+
+	// national transverse mercator grids
+	register(27700, "OSGB36 / British National Grid", datumOSGB36, transverseMercator{e: airy1830, lat0: 49, lon0: -2, k0: 0.9996012717, fe: 400000, fn: -100000}, 1)
+	register(2193, "NZGD2000 / New Zealand Transverse Mercator 2000", datumNZGD2000, transverseMercator{e: grs80, lon0: 173, k0: 0.9996, fe: 1600000, fn: 10000000}, 1)
+
+	// state plane, NAD83
+	caZone3 := lambertConformalConic{e: grs80, lat1: 38.43333333333333, lat2: 37.06666666666667, lat0: 36.5, lon0: -120.5, fe: 2000000, fn: 500000}
+	register(26943, "NAD83 / California zone 3", datumNAD83, caZone3, 1)
+	register(2227, "NAD83 / California zone 3 (ftUS)", datumNAD83, caZone3, usFoot)
+
+	caZone5 := lambertConformalConic{e: grs80, lat1: 35.46666666666667, lat2: 34.03333333333333, lat0: 33.5, lon0: -118, fe: 2000000, fn: 500000}
+	register(26945, "NAD83 / California zone 5", datumNAD83, caZone5, 1)
+	register(2229, "NAD83 / California zone 5 (ftUS)", datumNAD83, caZone5, usFoot)
+
+	coCentral := lambertConformalConic{e: grs80, lat1: 39.75, lat2: 38.45, lat0: 37.83333333333334, lon0: -105.5, fe: 914401.8289, fn: 304800.6096}
+	register(26954, "NAD83 / Colorado Central", datumNAD83, coCentral, 1)
+	register(2232, "NAD83 / Colorado Central (ftUS)", datumNAD83, coCentral, usFoot)
+
+	register(2263, "NAD83 / New York Long Island (ftUS)", datumNAD83, lambertConformalConic{e: grs80, lat1: 41.03333333333333, lat2: 40.66666666666666, lat0: 40.16666666666666, lon0: -74, fe: 300000}, usFoot)
+	register(32111, "NAD83 / New Jersey", datumNAD83, transverseMercator{e: grs80, lat0: 38.83333333333334, lon0: -74.5, k0: 0.9999, fe: 150000}, 1)
+
+	azCentral := transverseMercator{e: grs80, lat0: 31, lon0: -111.9166666666667, k0: 0.9999, fe: 213360}
+	register(26949, "NAD83 / Arizona Central", datumNAD83, azCentral, 1)
+	register(2223, "NAD83 / Arizona Central (ft)", datumNAD83, azCentral, intFoot)
+
+	register(32107, "NAD83 / Nevada East", datumNAD83, transverseMercator{e: grs80, lat0: 34.75, lon0: -115.5833333333333, k0: 0.9999, fe: 200000, fn: 8000000}, 1)
+	register(32108, "NAD83 / Nevada Central", datumNAD83, transverseMercator{e: grs80, lat0: 34.75, lon0: -116.6666666666667, k0: 0.9999, fe: 500000, fn: 6000000}, 1)
+	register(32109, "NAD83 / Nevada West", datumNAD83, transverseMercator{e: grs80, lat0: 34.75, lon0: -118.5833333333333, k0: 0.9999, fe: 800000, fn: 4000000}, 1)
+
+	// state plane, NAD27
+	register(26743, "NAD27 / California zone III", datumNAD27, lambertConformalConic{e: clarke66, lat1: 38.43333333333333, lat2: 37.06666666666667, lat0: 36.5, lon0: -120.5, fe: 609601.2192024384}, usFoot)
+}
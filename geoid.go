@@ -0,0 +1,158 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// HeightDatum ... what a Z is measured from
+type HeightDatum string
+
+const (
+	// Orthometric heights are above the geoid (mean sea level), as the world DEM is (the default)
+	Orthometric HeightDatum = "orthometric"
+
+	// Ellipsoidal heights are above the WGS84 ellipsoid, as most phone and drone GPS report
+	Ellipsoidal HeightDatum = "ellipsoidal"
+)
+
+// valid reports an error for an unknown height datum
+func (datum HeightDatum) valid() error {
+	switch datum {
+	case "", Orthometric, Ellipsoidal:
+		return nil
+	}
+	return fmt.Errorf("unknown height datum %q, use orthometric or ellipsoidal", datum)
+}
+
+// Geoid ... a geoid model, eg EGM96 or EGM2008, giving the height of the geoid above the
+// WGS84 ellipsoid.  An ellipsoidal height is the orthometric height plus the undulation.
+type Geoid struct {
+	grid *Grid
+}
+
+// ReadGeoid reads a geoid grid, either the NGA ascii .GRD of EGM96 (WW15MGH.GRD) or
+// EGM2008, or a GeoTIFF in EPSG:4326 such as PROJ's egm96_15.tif or egm08_25.tif
+func ReadGeoid(contents io.Reader) (*Geoid, error) {
+	r := bufio.NewReader(contents)
+
+	magic, err := r.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", errGridFormat, err)
+	}
+
+	var grid *Grid
+	switch string(magic) {
+	case "II*\x00", "MM\x00*":
+		grid, err = ReadGeoTIFF(r)
+	default:
+		grid, err = readGeoidGRD(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if grid.CRS != nil && !grid.CRS.IsGeographic() {
+		return nil, fmt.Errorf("%v: a geoid grid must be in lon lat, not %s", errGridFormat, grid.CRS.Name)
+	}
+
+	return &Geoid{grid: grid}, nil
+}
+
+// readGeoidGRD reads an NGA .GRD, a header of the south, north, west and east bounds and the
+// lat and lon spacing, then the undulations at each node, rows from the north
+func readGeoidGRD(contents io.Reader) (*Grid, error) {
+	scanner := bufio.NewScanner(contents)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	scanner.Split(bufio.ScanWords)
+
+	var values []float64
+	for scanner.Scan() {
+		v, err := strconv.ParseFloat(scanner.Text(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v: geoid grid value %s", errGridFormat, scanner.Text())
+		}
+		values = append(values, v)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(values) < 6 {
+		return nil, fmt.Errorf("%v: geoid grid header is incomplete", errGridFormat)
+	}
+	south, north, west, east, dlat, dlon := values[0], values[1], values[2], values[3], values[4], values[5]
+	if dlat <= 0 || dlon <= 0 {
+		return nil, fmt.Errorf("%v: geoid grid spacing %v x %v", errGridFormat, dlon, dlat)
+	}
+
+	// the values are at the nodes, so the cells are centered on them
+	cols := int(math.Round((east-west)/dlon)) + 1
+	rows := int(math.Round((north-south)/dlat)) + 1
+
+	return NewGrid(cols, rows, west-dlon/2, north+dlat/2, dlon, dlat, values[6:], nil)
+}
+
+// Undulation returns the height of the geoid above the ellipsoid at a lon lat, bilinear between nodes
+func (g *Geoid) Undulation(lon float64, lat float64) (float64, error) {
+	// a grid may run 0 to 360 rather than -180 to 180
+	for lon < g.grid.X0 {
+		lon += 360
+	}
+	for lon >= g.grid.X0+360 {
+		lon -= 360
+	}
+
+	n, err := (&gridInterpolator{grid: g.grid, mode: Bilinear}).ElevationAt(lon, lat)
+	if err != nil {
+		return 0, fmt.Errorf("no geoid undulation at %v, %v", lon, lat)
+	}
+	return n, nil
+}
+
+// geoids caches the geoid grids read from disk, by path
+var geoids = make(map[string]*Geoid)
+var geoidsLock sync.Mutex
+
+// LoadGeoid reads the geoid grid at path, see ReadGeoid, caching it for later conversions
+func LoadGeoid(path string) (*Geoid, error) {
+	geoidsLock.Lock()
+	defer geoidsLock.Unlock()
+
+	if geoid, ok := geoids[path]; ok {
+		return geoid, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error: geoid model cannot be found at %s", path)
+	}
+	defer f.Close()
+
+	geoid, err := ReadGeoid(f)
+	if err != nil {
+		return nil, fmt.Errorf("geoid model %s: %v", path, err)
+	}
+
+	geoids[path] = geoid
+	return geoid, nil
+}
+
+// needsGeoid reports whether the declared height datums call for the geoid
+func (o *Options) needsGeoid() bool {
+	return o.ZDatum == Ellipsoidal || o.OutputZDatum == Ellipsoidal
+}
+
+// undulation returns the geoid undulation at a lon lat, 0 without a geoid.  Outside the geoid
+// it's an error, rather than leaving an ellipsoidal height tens of meters off.
+func (o *Options) undulation(lon float64, lat float64) (float64, error) {
+	if o.Geoid == nil {
+		return 0, nil
+	}
+	return o.Geoid.Undulation(lon, lat)
+}
@@ -0,0 +1,285 @@
+package convert
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	geojson "github.com/paulmach/go.geojson"
+
+	// the pure go sqlite driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+// gpkgEnvelopes are the sizes of the envelope of a geopackage geometry, by its indicator
+var gpkgEnvelopes = []int{0, 32, 48, 48, 64}
+
+// DatasetFromGeoPackage converts a features layer of a geopackage, the only one if layer is
+// empty.  The layer's srs is declared, unless Options.SRS or a mine grid is.  A layer of the
+// undefined srs needs Options.SRS, or Options.GuessSRS to guess it from coordinate magnitude.
+func DatasetFromGeoPackage(layer string, contents io.Reader, opts ...Options) (*Datasets, error) {
+	db, cleanup, err := openGeoPackage(contents)
+	if err != nil {
+		return nil, fmt.Errorf("[DatasetFromGeoPackage] in pkg [convert] encountered: %v", err)
+	}
+	defer cleanup()
+
+	layers, err := geoPackageLayers(db)
+	if err != nil {
+		return nil, fmt.Errorf("[DatasetFromGeoPackage] in pkg [convert] encountered: %v", err)
+	}
+
+	if layer == "" {
+		if len(layers) != 1 {
+			return nil, fmt.Errorf("the geopackage has %d features layers, choose one of %s", len(layers), strings.Join(layers, ", "))
+		}
+		layer = layers[0]
+	}
+
+	found := false
+	for _, name := range layers {
+		found = found || name == layer
+	}
+	if !found {
+		return nil, fmt.Errorf("no features layer %s in the geopackage, choose one of %s", layer, strings.Join(layers, ", "))
+	}
+
+	var column string
+	var srsID int
+	err = db.QueryRow("SELECT column_name, srs_id FROM gpkg_geometry_columns WHERE table_name = ?", layer).Scan(&column, &srsID)
+	if err != nil {
+		return nil, fmt.Errorf("no geometry column for layer %s: %v", layer, err)
+	}
+
+	// -1 and 0 are the undefined cartesian and geographic srs
+	if srsID > 0 {
+		crs, err := geoPackageCRS(db, srsID)
+		if err != nil {
+			if len(opts) == 0 || (opts[0].SRS == 0 && opts[0].MineGrid == nil) {
+				return nil, fmt.Errorf("%v, declare Options.SRS", err)
+			}
+		} else if opts, err = declareCRS(crs, "geopackage srs", opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// ensure demvrt is set, unless an elevation provider is declared
+	options, err := resolveOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var outdataset Datasets
+	container := initExtentContainer(options)
+
+	if err := parseGeoPackageLayer(db, layer, column, &outdataset, container); err != nil {
+		close(container.ch)
+		return nil, fmt.Errorf("[ParseGeoPackage] in pkg [convert] layer %s encountered: %v", layer, err)
+	}
+
+	// close the BBOXlistener goroutine
+	close(container.ch)
+
+	// make sure there's valid features in the dataset
+	if len(outdataset.Points) == 0 && len(outdataset.Lines) == 0 && len(outdataset.Shapes) == 0 {
+		return nil, errors.New("no valid features in dataset")
+	}
+
+	// configure the center point... in 4326
+	c, err := getCenter(container)
+	if err != nil {
+		return nil, err
+	}
+	outdataset.Center = append(outdataset.Center, c)
+
+	// configure the s2 array... in 4326
+	outdataset.S2 = s2covering(container)
+
+	// record how the dataset was read
+	outdataset.Metadata = container.options().metadata()
+
+	return &outdataset, nil
+}
+
+// GeoPackageLayers lists the features layers of a geopackage, to choose one to convert
+func GeoPackageLayers(contents io.Reader) ([]string, error) {
+	db, cleanup, err := openGeoPackage(contents)
+	if err != nil {
+		return nil, fmt.Errorf("[GeoPackageLayers] in pkg [convert] encountered: %v", err)
+	}
+	defer cleanup()
+
+	return geoPackageLayers(db)
+}
+
+// openGeoPackage opens a geopackage with the sqlite driver, which reads files, so anything
+// but an *os.File is copied to a temporary file first.  cleanup closes and removes it.
+func openGeoPackage(contents io.Reader) (*sql.DB, func(), error) {
+	var path string
+	var remove func()
+
+	if f, ok := contents.(*os.File); ok {
+		path = f.Name()
+		remove = func() {}
+	} else {
+		tmp, err := ioutil.TempFile("", "convert-*.gpkg")
+		if err != nil {
+			return nil, nil, err
+		}
+		remove = func() { os.Remove(tmp.Name()) }
+
+		_, err = io.Copy(tmp, contents)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			remove()
+			return nil, nil, err
+		}
+		path = tmp.Name()
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		remove()
+		return nil, nil, err
+	}
+
+	return db, func() { db.Close(); remove() }, nil
+}
+
+// geoPackageLayers lists the tables of the features in gpkg_contents
+func geoPackageLayers(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT table_name FROM gpkg_contents WHERE data_type = 'features' ORDER BY table_name")
+	if err != nil {
+		return nil, fmt.Errorf("not a geopackage: %v", err)
+	}
+	defer rows.Close()
+
+	var layers []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		layers = append(layers, name)
+	}
+	return layers, rows.Err()
+}
+
+// geoPackageCRS resolves an srs of gpkg_spatial_ref_sys, by its EPSG code or its wkt
+func geoPackageCRS(db *sql.DB, srsID int) (*CRS, error) {
+	var organization, definition sql.NullString
+	var code sql.NullInt64
+	err := db.QueryRow("SELECT organization, organization_coordsys_id, definition FROM gpkg_spatial_ref_sys WHERE srs_id = ?", srsID).Scan(&organization, &code, &definition)
+	if err != nil {
+		return nil, fmt.Errorf("geopackage srs %d is undefined: %v", srsID, err)
+	}
+
+	if strings.EqualFold(organization.String, "EPSG") && code.Valid {
+		if crs, err := LookupEPSG(int(code.Int64)); err == nil {
+			return crs, nil
+		}
+	}
+	return LookupPRJ(definition.String)
+}
+
+// parseGeoPackageLayer converts the rows of a features table, the other columns in order as
+// the attributes of each feature
+func parseGeoPackageLayer(db *sql.DB, layer string, column string, outdataset *Datasets, container *ExtentContainer) error {
+	rows, err := db.Query(`SELECT * FROM "` + strings.Replace(layer, `"`, `""`, -1) + `"`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	geom := -1
+	var headers []string
+	for i, name := range columns {
+		if strings.EqualFold(name, column) {
+			geom = i
+			continue
+		}
+		headers = append(headers, propertyKey(name))
+	}
+	if geom < 0 {
+		return fmt.Errorf("no geometry column %s", column)
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for row := 1; rows.Next(); row++ {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+
+		blob, _ := values[geom].([]byte)
+		geometry, err := decodeGPKG(blob)
+		if err != nil {
+			fmt.Printf("NonFatal [decodeGPKG] row %d encountered %v\n", row, err.Error())
+			continue
+		}
+		if geometry == nil {
+			continue
+		}
+
+		properties := make(map[string]interface{})
+		for i, value := range values {
+			if i == geom || value == nil {
+				continue
+			}
+			if text, ok := value.([]byte); ok {
+				value = string(text)
+			}
+			properties[propertyKey(columns[i])] = value
+		}
+
+		if err := parseFeatureGeometries(splitGeometry(geometry), properties, headers, outdataset, container); err != nil {
+			fmt.Printf("NonFatal [parseFeatureGeometries] row %d encountered %v\n", row, err.Error())
+		}
+	}
+
+	return rows.Err()
+}
+
+// decodeGPKG reads a geopackage geometry blob, its header then its wkb, nil if it's empty
+func decodeGPKG(b []byte) (*geojson.Geometry, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if len(b) < 8 || b[0] != 'G' || b[1] != 'P' {
+		return nil, errors.New("not a geopackage geometry")
+	}
+
+	flags := b[3]
+	if flags&0x10 != 0 {
+		return nil, nil
+	}
+
+	envelope := int(flags>>1) & 7
+	if envelope >= len(gpkgEnvelopes) {
+		return nil, fmt.Errorf("geopackage envelope indicator %d", envelope)
+	}
+
+	start := 8 + gpkgEnvelopes[envelope]
+	if len(b) < start {
+		return nil, fmt.Errorf("%v: truncated", errWKB)
+	}
+
+	// the srs is that of the layer, not of the header or the wkb
+	geometry, _, err := DecodeWKB(b[start:])
+	return geometry, err
+}
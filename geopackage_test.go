@@ -0,0 +1,81 @@
+package convert
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const (
+	//geopackage testing dataset
+	surveygpkg = "tests/geopackage/survey.gpkg"
+)
+
+func TestGeoPackage(t *testing.T) {
+
+	data, err := os.Open(surveygpkg)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer data.Close()
+
+	layers, err := GeoPackageLayers(data)
+	if err != nil || len(layers) != 2 || layers[0] != "claims" || layers[1] != "samples" {
+		t.Errorf("%s layers were %v, %v expected claims and samples\n", surveygpkg, layers, err)
+	}
+
+	// two features layers, one must be chosen
+	if _, err := DatasetFromGeoPackage("", data, Options{Elevation: ConstantProvider{}}); err == nil {
+		t.Errorf("an unnamed layer of a geopackage with two should be refused\n")
+	}
+
+	// no srs declared, the layer has it
+	results, err := DatasetFromGeoPackage("samples", data, Options{Elevation: ConstantProvider{Z: 1234}})
+	if err != nil {
+		t.Errorf("geopackage conversion error for %s: %v\n", surveygpkg, err)
+		return
+	}
+
+	// the multipoint is two points, the empty geometry is skipped
+	if len(results.Points) != 4 {
+		t.Errorf("%s had %d points, expected 4\n", surveygpkg, len(results.Points))
+		return
+	}
+
+	utm := Options{SRS: 32612}
+	expected, _ := utm.checkCoords([]float64{392500, 3770000, 1510.5})
+	point := results.Points[0]
+	if point.Points[0] != expected[0] || point.Points[1] != expected[1] || point.Points[2] != expected[2] {
+		t.Errorf("first sample was %v, expected %v\n", point.Points, expected)
+	}
+
+	// columns in order, the name column as the name
+	want := []Attribute{{Key: "au_gpt", Value: "1.25"}, {Key: "holes", Value: "3"}}
+	if point.Name != "S-001" || len(point.Attributes) != len(want) {
+		t.Errorf("first sample %q had attributes %v, expected S-001 with %v\n", point.Name, point.Attributes, want)
+		return
+	}
+	for i, att := range want {
+		if point.Attributes[i] != att {
+			t.Errorf("first sample attribute %d was %v, expected %v\n", i, point.Attributes[i], att)
+		}
+	}
+
+	// a big endian point without z is filled from the dem
+	if results.Points[1].Points[2] != 1234 {
+		t.Errorf("second sample z was %v, expected the dem's 1234\n", results.Points[1].Points[2])
+	}
+
+	// any reader will do, and the layer's srs must agree with the declared one
+	raw, _ := ioutil.ReadFile(surveygpkg)
+	claims, err := DatasetFromGeoPackage("claims", bytes.NewReader(raw), Options{SRS: 32612, Elevation: ConstantProvider{}})
+	if err != nil || len(claims.Shapes) != 1 || claims.Shapes[0].Name != "Claim A" {
+		t.Errorf("claims layer was %v, %v expected Claim A\n", claims, err)
+	}
+
+	if _, err := DatasetFromGeoPackage("claims", bytes.NewReader(raw), Options{SRS: 4326, Elevation: ConstantProvider{}}); err == nil {
+		t.Errorf("a layer srs conflicting with the declared srs should be refused\n")
+	}
+}
@@ -0,0 +1,500 @@
+package convert
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// tiff and geotiff tags used by ReadGeoTIFF
+const (
+	tagImageWidth      = 256
+	tagImageLength     = 257
+	tagBitsPerSample   = 258
+	tagCompression     = 259
+	tagStripOffsets    = 273
+	tagSamplesPerPixel = 277
+	tagRowsPerStrip    = 278
+	tagStripByteCounts = 279
+	tagPlanarConfig    = 284
+	tagPredictor       = 317
+	tagTileWidth       = 322
+	tagTileLength      = 323
+	tagTileOffsets     = 324
+	tagTileByteCounts  = 325
+	tagSampleFormat    = 339
+	tagModelPixelScale = 33550
+	tagModelTiepoint   = 33922
+	tagModelTransform  = 34264
+	tagGeoKeyDirectory = 34735
+	tagGDALNoData      = 42113
+
+	// geokeys
+	keyRasterType    = 1025
+	keyGeographicCRS = 2048
+	keyProjectedCRS  = 3072
+
+	rasterPixelIsPoint = 2
+	userDefined        = 32767
+)
+
+// tiffTypeSize is the byte size of each tiff field type
+var tiffTypeSize = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 16: 8}
+
+// tiffField ... a raw ifd entry
+type tiffField struct {
+	kind  uint16
+	count int
+	data  []byte
+}
+
+// geotiff ... a decoded tiff directory
+type geotiff struct {
+	order  binary.ByteOrder
+	raw    []byte
+	fields map[uint16]tiffField
+}
+
+// ReadGeoTIFF reads the first band of a GeoTIFF DEM into a Grid, for Options.Elevation
+// Strips or tiles, uncompressed, deflate or LZW, with or without a predictor, are supported.
+// The crs is taken from the geokeys, and must be a registered EPSG code.
+func ReadGeoTIFF(contents io.Reader) (*Grid, error) {
+	raw, err := ioutil.ReadAll(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	tif, err := decodeTIFFHeader(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	cols, rows := tif.int(tagImageWidth, 0), tif.int(tagImageLength, 0)
+	bits := tif.int(tagBitsPerSample, 1)
+	format := tif.int(tagSampleFormat, 1)
+	samples := tif.int(tagSamplesPerPixel, 1)
+	compression := tif.int(tagCompression, 1)
+	predictor := tif.int(tagPredictor, 1)
+
+	if cols == 0 || rows == 0 {
+		return nil, fmt.Errorf("%v: no image size", errGridFormat)
+	}
+
+	if samples > 1 && tif.int(tagPlanarConfig, 1) != 1 {
+		return nil, fmt.Errorf("%v: separate planes", errGridFormat)
+	}
+
+	sample, err := sampleReader(tif.order, bits, format)
+	if err != nil {
+		return nil, err
+	}
+
+	// strips are tiles as wide as the image
+	tileWidth, tileLength := tif.int(tagTileWidth, 0), tif.int(tagTileLength, 0)
+	offsets, counts := tif.ints(tagTileOffsets), tif.ints(tagTileByteCounts)
+	if tileWidth == 0 {
+		tileWidth, tileLength = cols, tif.int(tagRowsPerStrip, rows)
+		offsets, counts = tif.ints(tagStripOffsets), tif.ints(tagStripByteCounts)
+	}
+
+	if len(offsets) == 0 || len(offsets) != len(counts) {
+		return nil, fmt.Errorf("%v: no image data", errGridFormat)
+	}
+
+	nodata := math.NaN()
+	if field, ok := tif.fields[tagGDALNoData]; ok {
+		if v, err := strconv.ParseFloat(strings.Trim(string(field.data), "\x00 "), 64); err == nil {
+			nodata = v
+		}
+	}
+
+	values := make([]float64, cols*rows)
+	for i := range values {
+		values[i] = math.NaN()
+	}
+
+	bytesPerSample := bits / 8
+	across := (cols + tileWidth - 1) / tileWidth
+	for t, offset := range offsets {
+		if offset+counts[t] > len(raw) {
+			return nil, fmt.Errorf("%v: truncated image data", errGridFormat)
+		}
+
+		data, err := decompressTIFF(compression, raw[offset:offset+counts[t]])
+		if err != nil {
+			return nil, err
+		}
+
+		stride := tileWidth * samples * bytesPerSample
+		if err := unpredict(predictor, data, stride, samples, bytesPerSample, tif.order); err != nil {
+			return nil, err
+		}
+
+		left, top := (t%across)*tileWidth, (t/across)*tileLength
+		for r := 0; r < tileLength && top+r < rows; r++ {
+			for c := 0; c < tileWidth && left+c < cols; c++ {
+				at := (r*tileWidth + c) * samples * bytesPerSample
+				if at+bytesPerSample > len(data) {
+					continue
+				}
+
+				v := sample(data[at:])
+				if v == nodata {
+					v = math.NaN()
+				}
+				values[(top+r)*cols+left+c] = v
+			}
+		}
+	}
+
+	x0, y0, dx, dy, err := tif.georeference()
+	if err != nil {
+		return nil, err
+	}
+
+	crs, err := tif.crs()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewGrid(cols, rows, x0, y0, dx, dy, values, crs)
+}
+
+// decodeTIFFHeader reads the byte order and first ifd of a tiff
+func decodeTIFFHeader(raw []byte) (*geotiff, error) {
+	if len(raw) < 8 {
+		return nil, fmt.Errorf("%v: not a tiff", errGridFormat)
+	}
+
+	tif := geotiff{raw: raw, fields: make(map[uint16]tiffField)}
+	switch string(raw[0:2]) {
+	case "II":
+		tif.order = binary.LittleEndian
+	case "MM":
+		tif.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%v: not a tiff", errGridFormat)
+	}
+
+	if tif.order.Uint16(raw[2:4]) != 42 {
+		return nil, fmt.Errorf("%v: only classic tiff, not bigtiff, is supported", errGridFormat)
+	}
+
+	ifd := int(tif.order.Uint32(raw[4:8]))
+	if ifd+2 > len(raw) {
+		return nil, fmt.Errorf("%v: truncated tiff", errGridFormat)
+	}
+
+	n := int(tif.order.Uint16(raw[ifd:]))
+	for i := 0; i < n; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(raw) {
+			return nil, fmt.Errorf("%v: truncated tiff", errGridFormat)
+		}
+
+		tag := tif.order.Uint16(raw[entry:])
+		kind := tif.order.Uint16(raw[entry+2:])
+		count := int(tif.order.Uint32(raw[entry+4:]))
+
+		size, ok := tiffTypeSize[kind]
+		if !ok {
+			continue
+		}
+
+		// values of 4 bytes or less are held in the entry itself
+		data := raw[entry+8 : entry+12]
+		if size*count > 4 {
+			offset := int(tif.order.Uint32(raw[entry+8:]))
+			if offset+size*count > len(raw) {
+				return nil, fmt.Errorf("%v: truncated tiff tag %d", errGridFormat, tag)
+			}
+			data = raw[offset : offset+size*count]
+		}
+
+		tif.fields[tag] = tiffField{kind: kind, count: count, data: data}
+	}
+
+	return &tif, nil
+}
+
+// floats returns the values of a numeric tag
+func (tif *geotiff) floats(tag uint16) []float64 {
+	field, ok := tif.fields[tag]
+	if !ok {
+		return nil
+	}
+
+	var values []float64
+	for i := 0; i < field.count; i++ {
+		switch field.kind {
+		case 1, 7:
+			values = append(values, float64(field.data[i]))
+		case 3:
+			values = append(values, float64(tif.order.Uint16(field.data[2*i:])))
+		case 8:
+			values = append(values, float64(int16(tif.order.Uint16(field.data[2*i:]))))
+		case 4:
+			values = append(values, float64(tif.order.Uint32(field.data[4*i:])))
+		case 9:
+			values = append(values, float64(int32(tif.order.Uint32(field.data[4*i:]))))
+		case 11:
+			values = append(values, float64(math.Float32frombits(tif.order.Uint32(field.data[4*i:]))))
+		case 12:
+			values = append(values, math.Float64frombits(tif.order.Uint64(field.data[8*i:])))
+		case 16:
+			values = append(values, float64(tif.order.Uint64(field.data[8*i:])))
+		case 5:
+			values = append(values, float64(tif.order.Uint32(field.data[8*i:]))/float64(tif.order.Uint32(field.data[8*i+4:])))
+		}
+	}
+	return values
+}
+
+// ints returns the values of an integer tag
+func (tif *geotiff) ints(tag uint16) []int {
+	var values []int
+	for _, v := range tif.floats(tag) {
+		values = append(values, int(v))
+	}
+	return values
+}
+
+// int returns the first value of an integer tag, or the default
+func (tif *geotiff) int(tag uint16, def int) int {
+	if values := tif.ints(tag); len(values) > 0 {
+		return values[0]
+	}
+	return def
+}
+
+// georeference returns the outer top left corner and cell size of the image
+func (tif *geotiff) georeference() (float64, float64, float64, float64, error) {
+	var x0, y0, dx, dy float64
+
+	scale, tiepoint := tif.floats(tagModelPixelScale), tif.floats(tagModelTiepoint)
+	transform := tif.floats(tagModelTransform)
+
+	switch {
+	case len(scale) >= 2 && len(tiepoint) >= 6:
+		dx, dy = scale[0], scale[1]
+		x0 = tiepoint[3] - tiepoint[0]*dx
+		y0 = tiepoint[4] + tiepoint[1]*dy
+
+	case len(transform) == 16:
+		if transform[1] != 0 || transform[4] != 0 {
+			return 0, 0, 0, 0, fmt.Errorf("%v: rotated images", errGridFormat)
+		}
+		dx, dy = transform[0], -transform[5]
+		x0, y0 = transform[3], transform[7]
+
+	default:
+		return 0, 0, 0, 0, fmt.Errorf("%v: not georeferenced", errGridFormat)
+	}
+
+	// the tiepoint is the center of the top left cell, not its corner
+	if tif.geokey(keyRasterType) == rasterPixelIsPoint {
+		x0 -= dx / 2
+		y0 += dy / 2
+	}
+
+	return x0, y0, dx, dy, nil
+}
+
+// geokey returns the short value of a geokey, 0 if absent
+func (tif *geotiff) geokey(key int) int {
+	keys := tif.ints(tagGeoKeyDirectory)
+	for i := 4; i+3 < len(keys); i += 4 {
+		if keys[i] == key && keys[i+1] == 0 {
+			return keys[i+3]
+		}
+	}
+	return 0
+}
+
+// crs returns the registered crs of the geokeys, nil for EPSG:4326
+func (tif *geotiff) crs() (*CRS, error) {
+	code := tif.geokey(keyProjectedCRS)
+	if code == 0 {
+		code = tif.geokey(keyGeographicCRS)
+	}
+
+	switch code {
+	case 0, 4326:
+		return nil, nil
+	case userDefined:
+		return nil, fmt.Errorf("%v: user defined crs, only registered EPSG codes are supported", errGridFormat)
+	}
+
+	return LookupEPSG(code)
+}
+
+// sampleReader returns a reader for a single sample of the format
+func sampleReader(order binary.ByteOrder, bits int, format int) (func([]byte) float64, error) {
+	switch {
+	case format == 3 && bits == 32:
+		return func(b []byte) float64 { return float64(math.Float32frombits(order.Uint32(b))) }, nil
+	case format == 3 && bits == 64:
+		return func(b []byte) float64 { return math.Float64frombits(order.Uint64(b)) }, nil
+	case format == 2 && bits == 8:
+		return func(b []byte) float64 { return float64(int8(b[0])) }, nil
+	case format == 2 && bits == 16:
+		return func(b []byte) float64 { return float64(int16(order.Uint16(b))) }, nil
+	case format == 2 && bits == 32:
+		return func(b []byte) float64 { return float64(int32(order.Uint32(b))) }, nil
+	case format == 1 && bits == 8:
+		return func(b []byte) float64 { return float64(b[0]) }, nil
+	case format == 1 && bits == 16:
+		return func(b []byte) float64 { return float64(order.Uint16(b)) }, nil
+	case format == 1 && bits == 32:
+		return func(b []byte) float64 { return float64(order.Uint32(b)) }, nil
+	}
+	return nil, fmt.Errorf("%v: %d bit samples of format %d", errGridFormat, bits, format)
+}
+
+// decompressTIFF inflates a strip or tile
+func decompressTIFF(compression int, data []byte) ([]byte, error) {
+	switch compression {
+	case 1:
+		return data, nil
+	case 8, 32946:
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	case 5:
+		return decodeTIFFLZW(data)
+	}
+	return nil, fmt.Errorf("%v: compression %d", errGridFormat, compression)
+}
+
+// unpredict undoes the horizontal differencing of predictor 2, or the byte shuffle of predictor 3
+func unpredict(predictor int, data []byte, stride int, samples int, size int, order binary.ByteOrder) error {
+	switch predictor {
+	case 1:
+		return nil
+
+	case 2:
+		for row := 0; row+stride <= len(data); row += stride {
+			for i := samples * size; i < stride; i += size {
+				prev := i - samples*size
+				switch size {
+				case 1:
+					data[row+i] += data[row+prev]
+				case 2:
+					order.PutUint16(data[row+i:], order.Uint16(data[row+i:])+order.Uint16(data[row+prev:]))
+				case 4:
+					order.PutUint32(data[row+i:], order.Uint32(data[row+i:])+order.Uint32(data[row+prev:]))
+				}
+			}
+		}
+		return nil
+
+	case 3:
+		// bytes are differenced, then split into planes of most significant byte first
+		row := make([]byte, stride)
+		for start := 0; start+stride <= len(data); start += stride {
+			for i := samples; i < stride; i++ {
+				data[start+i] += data[start+i-samples]
+			}
+
+			count := stride / size
+			for i := 0; i < count; i++ {
+				for b := 0; b < size; b++ {
+					// planes are big endian, the samples are in the tiff's order
+					plane := data[start+b*count+i]
+					if order == binary.LittleEndian {
+						row[i*size+size-1-b] = plane
+					} else {
+						row[i*size+b] = plane
+					}
+				}
+			}
+			copy(data[start:], row)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%v: predictor %d", errGridFormat, predictor)
+}
+
+// decodeTIFFLZW decodes tiff flavoured LZW, msb first with early code width change
+func decodeTIFFLZW(data []byte) ([]byte, error) {
+	const clearCode, eoiCode = 256, 257
+
+	var out []byte
+	var table [][]byte
+	var prev []byte
+	width := 9
+
+	reset := func() {
+		table = table[:0]
+		for i := 0; i < 256; i++ {
+			table = append(table, []byte{byte(i)})
+		}
+		table = append(table, nil, nil)
+		width = 9
+		prev = nil
+	}
+	reset()
+
+	var bitbuf uint32
+	var nbits int
+	pos := 0
+
+	for {
+		for nbits < width {
+			if pos >= len(data) {
+				return out, nil
+			}
+			bitbuf = bitbuf<<8 | uint32(data[pos])
+			pos++
+			nbits += 8
+		}
+		code := int(bitbuf>>uint(nbits-width)) & (1<<uint(width) - 1)
+		nbits -= width
+
+		switch {
+		case code == clearCode:
+			reset()
+			continue
+		case code == eoiCode:
+			return out, nil
+		}
+
+		var entry []byte
+		switch {
+		case code < len(table) && table[code] != nil:
+			entry = table[code]
+		case code == len(table) && prev != nil:
+			entry = append(append([]byte(nil), prev...), prev[0])
+		default:
+			return nil, errors.New("invalid LZW code in tiff")
+		}
+
+		out = append(out, entry...)
+
+		if prev != nil {
+			table = append(table, append(append([]byte(nil), prev...), entry[0]))
+		}
+		prev = entry
+
+		// the early change, the width grows a code before the table fills
+		switch len(table) + 1 {
+		case 512:
+			width = 10
+		case 1024:
+			width = 11
+		case 2048:
+			width = 12
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package convert
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// gpxFile ... a gpx document, its metadata and its features.  GPX 1.0 has no metadata element,
+// its name, desc and author are those of the root.
+type gpxFile struct {
+	Name      string      `xml:"name"`
+	Desc      string      `xml:"desc"`
+	Author    gpxPerson   `xml:"author"`
+	Email     gpxEmail    `xml:"email"`
+	Metadata  gpxMetadata `xml:"metadata"`
+	Waypoints []gpxPoint  `xml:"wpt"`
+	Routes    []gpxRoute  `xml:"rte"`
+	Tracks    []gpxTrack  `xml:"trk"`
+}
+
+// gpxMetadata ... what a GPX 1.1 document says of itself
+type gpxMetadata struct {
+	Name   string    `xml:"name"`
+	Desc   string    `xml:"desc"`
+	Author gpxPerson `xml:"author"`
+}
+
+// gpxPerson ... an author, a name and email in GPX 1.1, or text in GPX 1.0
+type gpxPerson struct {
+	Name  string   `xml:"name"`
+	Email gpxEmail `xml:"email"`
+	Text  string   `xml:",chardata"`
+}
+
+// gpxEmail ... an address, split in its id and domain in GPX 1.1, or text in GPX 1.0
+type gpxEmail struct {
+	ID     string `xml:"id,attr"`
+	Domain string `xml:"domain,attr"`
+	Text   string `xml:",chardata"`
+}
+
+// gpxPoint ... a waypoint, or a vertex of a route or track segment
+type gpxPoint struct {
+	Lat        float64       `xml:"lat,attr"`
+	Lon        float64       `xml:"lon,attr"`
+	Ele        *float64      `xml:"ele"`
+	Time       string        `xml:"time"`
+	Name       string        `xml:"name"`
+	Extensions gpxExtensions `xml:"extensions"`
+}
+
+// gpxRoute ... a route, its vertices
+type gpxRoute struct {
+	Name       string        `xml:"name"`
+	Points     []gpxPoint    `xml:"rtept"`
+	Extensions gpxExtensions `xml:"extensions"`
+}
+
+// gpxTrack ... a track, its segments broken where the gps lost its fix
+type gpxTrack struct {
+	Name       string        `xml:"name"`
+	Segments   []gpxSegment  `xml:"trkseg"`
+	Extensions gpxExtensions `xml:"extensions"`
+}
+
+// gpxSegment ... a continuous run of track points
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+// gpxExtensions ... the extension fields of a feature, eg the ogr:* attributes GDAL writes
+type gpxExtensions struct {
+	Fields []struct {
+		XMLName xml.Name
+		Value   string `xml:",chardata"`
+	} `xml:",any"`
+}
+
+// decodeGPX reads a gpx document.  A truncated or malformed document keeps the features read
+// before the error, if there are any.
+func decodeGPX(contents io.Reader) (*gpxFile, error) {
+	var gpx gpxFile
+	if err := xml.NewDecoder(contents).Decode(&gpx); err != nil {
+		features := len(gpx.Waypoints) + len(gpx.Routes) + len(gpx.Tracks)
+		if features == 0 {
+			return nil, fmt.Errorf("unreadable gpx: %v", err)
+		}
+
+		fmt.Printf("Warning: [decodeGPX] in pkg [convert] kept %d features of a gpx that encountered: %v\n", features, err)
+	}
+	return &gpx, nil
+}
+
+// name is the name of the document, of its metadata or, in GPX 1.0, of its root
+func (gpx *gpxFile) name() string {
+	if name := strings.TrimSpace(gpx.Metadata.Name); name != "" {
+		return name
+	}
+	return strings.TrimSpace(gpx.Name)
+}
+
+// metadata is the description and author of the document, as dataset metadata
+func (gpx *gpxFile) metadata() []Attribute {
+	var metadata []Attribute
+
+	desc := strings.TrimSpace(gpx.Metadata.Desc)
+	if desc == "" {
+		desc = strings.TrimSpace(gpx.Desc)
+	}
+	if desc != "" {
+		metadata = append(metadata, Attribute{Key: "description", Value: desc})
+	}
+
+	author := gpx.Metadata.Author.String()
+	if author == "" {
+		// GPX 1.0 keeps the email beside the author
+		author = gpxPerson{Name: gpx.Author.Text, Email: gpx.Email}.String()
+	}
+	if author != "" {
+		metadata = append(metadata, Attribute{Key: "author", Value: author})
+	}
+
+	return metadata
+}
+
+// String is the person's name and email, eg Jane Doe <jane@example.com>
+func (person gpxPerson) String() string {
+	name := strings.TrimSpace(person.Name)
+	if name == "" {
+		name = strings.TrimSpace(person.Text)
+	}
+
+	email := strings.TrimSpace(person.Email.Text)
+	if person.Email.ID != "" {
+		email = person.Email.ID + "@" + person.Email.Domain
+	}
+
+	switch {
+	case email == "":
+		return name
+	case name == "":
+		return email
+	}
+	return name + " <" + email + ">"
+}
+
+// attributes are the extension fields that have a value, in order
+func (extensions gpxExtensions) attributes() []Attribute {
+	var attributes []Attribute
+	for _, field := range extensions.Fields {
+		if value := strings.TrimSpace(field.Value); value != "" {
+			attributes = append(attributes, Attribute{Key: field.XMLName.Local, Value: value})
+		}
+	}
+	return attributes
+}
+
+// coordinate is the point as x y z, or x y if it has no elevation, so the dem fills it
+func (point gpxPoint) coordinate() []float64 {
+	if point.Ele == nil {
+		return []float64{point.Lon, point.Lat}
+	}
+	return []float64{point.Lon, point.Lat, *point.Ele}
+}
+
+// parseGPXPoint converts a waypoint, its time as the time attribute
+func parseGPXPoint(record gpxPoint, outdataset *Datasets, container *ExtentContainer) error {
+	attributes := record.Extensions.attributes()
+	if time := strings.TrimSpace(record.Time); time != "" {
+		attributes = append(attributes, Attribute{Key: "time", Value: time})
+	}
+
+	parsedgeom, err := ParseNestedGeom(container, record.coordinate())
+	if err != nil {
+		return err
+	}
+
+	newfeature := Points{Attributes: attributes, Name: record.Name}
+	newfeature.Points = parsedgeom.([]float64)
+	outdataset.Points = append(outdataset.Points, newfeature)
+	return nil
+}
+
+// parseGPXLine converts the vertices of a route or a track segment, their times as the line's
+// Times, if any vertex has one
+func parseGPXLine(name string, attributes []Attribute, points []gpxPoint, outdataset *Datasets, container *ExtentContainer) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	line := make([][]float64, len(points))
+	times := make([]string, len(points))
+	timed := false
+	for i, point := range points {
+		line[i] = point.coordinate()
+		times[i] = strings.TrimSpace(point.Time)
+		timed = timed || times[i] != ""
+	}
+
+	parsedgeom, err := ParseNestedGeom(container, line)
+	if err != nil {
+		return err
+	}
+
+	newfeature := Lines{Attributes: attributes, Name: name}
+	newfeature.Points = parsedgeom.([][]float64)
+	if timed {
+		newfeature.Times = alignTimes(line, times, newfeature.Points, container)
+	}
+	outdataset.Lines = append(outdataset.Lines, newfeature)
+	return nil
+}
+
+// alignTimes matches the times of a line's vertices to the vertices of the parsed line, which
+// Options.Drape may have densified.  The vertices it inserts have no time.
+func alignTimes(line [][]float64, times []string, parsed [][]float64, container *ExtentContainer) []string {
+	if len(parsed) == len(line) {
+		return times
+	}
+
+	aligned := make([]string, len(parsed))
+	next := 0
+	for i, vertex := range parsed {
+		if next == len(line) {
+			break
+		}
+
+		x, y, err := container.options().to3857(line[next][0], line[next][1])
+		if err != nil {
+			break
+		}
+		if vertex[0] == x && vertex[1] == y {
+			aligned[i] = times[next]
+			next++
+		}
+	}
+	return aligned
+}
+
+// parseGPXTrack converts each segment of a track to a line of its own, so a gap in the fix
+// isn't drawn.  The segments of a track of several are numbered by the segment attribute.
+func parseGPXTrack(record gpxTrack, outdataset *Datasets, container *ExtentContainer) error {
+	attributes := record.Extensions.attributes()
+
+	for i, segment := range record.Segments {
+		segmentattributes := append([]Attribute(nil), attributes...)
+		if len(record.Segments) > 1 {
+			segmentattributes = append(segmentattributes, Attribute{Key: "segment", Value: strconv.Itoa(i + 1)})
+		}
+
+		if err := parseGPXLine(record.Name, segmentattributes, segment.Points, outdataset, container); err != nil {
+			return fmt.Errorf("segment %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package convert
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	//gpx testing datasets
+	segmentsgpx = "tests/gpx/segments.gpx"
+	author10gpx = "tests/gpx/author10.gpx"
+)
+
+func TestGPXSegments(t *testing.T) {
+
+	data, err := os.Open(segmentsgpx)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer data.Close()
+
+	results, err := DatasetFromGPX("", "", "", data, Options{Elevation: ConstantProvider{Z: 1234}})
+	if err != nil {
+		t.Errorf("gpx conversion error for %s: %v\n", segmentsgpx, err)
+		return
+	}
+
+	// the metadata name, description and author
+	if results.Name != "Bonanza traverse" {
+		t.Errorf("%s was named %q, expected Bonanza traverse\n", segmentsgpx, results.Name)
+	}
+	if desc := attributeOf(results.Metadata, "description"); desc != "Mapping traverse along the ridge, two gaps in the fix" {
+		t.Errorf("%s description was %q\n", segmentsgpx, desc)
+	}
+	if author := attributeOf(results.Metadata, "author"); author != "Field Crew 2 <crew2@example.com>" {
+		t.Errorf("%s author was %q, expected Field Crew 2 <crew2@example.com>\n", segmentsgpx, author)
+	}
+
+	// a waypoint keeps its time and extensions
+	if len(results.Points) != 1 || attributeOf(results.Points[0].Attributes, "time") != "2021-07-14T15:10:00Z" || attributeOf(results.Points[0].Attributes, "lithology") != "Quartzite" {
+		t.Errorf("%s waypoints were %v, expected Outcrop 7 with its time and lithology\n", segmentsgpx, results.Points)
+	}
+
+	// a line per segment, the empty one skipped, not one line jumping the gap
+	if len(results.Lines) != 3 {
+		t.Errorf("%s had %d lines, expected 3\n", segmentsgpx, len(results.Lines))
+		return
+	}
+
+	want := []struct {
+		name    string
+		segment string
+		points  int
+		times   []string
+	}{
+		{"Ridge", "1", 3, []string{"2021-07-14T15:10:00Z", "2021-07-14T15:11:00Z", "2021-07-14T15:12:00Z"}},
+		{"Ridge", "2", 2, []string{"2021-07-14T15:30:00Z", ""}},
+		{"Return", "", 2, nil},
+	}
+	for i, line := range results.Lines {
+		if line.Name != want[i].name || attributeOf(line.Attributes, "segment") != want[i].segment || len(line.Points) != want[i].points {
+			t.Errorf("line %d was %s segment %q of %d points, expected %s segment %q of %d\n", i, line.Name, attributeOf(line.Attributes, "segment"), len(line.Points), want[i].name, want[i].segment, want[i].points)
+		}
+
+		// the times parallel the vertices, absent if no vertex has one
+		if len(line.Times) != len(want[i].times) {
+			t.Errorf("line %d times were %v, expected %v\n", i, line.Times, want[i].times)
+			continue
+		}
+		for j, time := range want[i].times {
+			if line.Times[j] != time {
+				t.Errorf("line %d vertex %d time was %q, expected %q\n", i, j, line.Times[j], time)
+			}
+		}
+	}
+
+	// every segment of a track keeps the track's attributes
+	if attributeOf(results.Lines[1].Attributes, "crew") != "2" {
+		t.Errorf("second segment attributes were %v, expected the track's crew\n", results.Lines[1].Attributes)
+	}
+
+	// densified by the drape, the inserted vertices have no time
+	data.Seek(0, 0)
+	draped, err := DatasetFromGPX("", "", "", data, Options{Elevation: ConstantProvider{Z: 1234}, Drape: true, DrapeSpacing: 10, AltitudeMode: RelativeToGround})
+	if err != nil {
+		t.Errorf("gpx conversion error for %s: %v\n", segmentsgpx, err)
+		return
+	}
+	line := draped.Lines[0]
+	if len(line.Points) <= 3 || len(line.Times) != len(line.Points) || line.Times[0] != want[0].times[0] || line.Times[len(line.Times)-1] != want[0].times[2] || line.Times[1] != "" {
+		t.Errorf("draped line of %d points had times %v, expected the first and last kept\n", len(line.Points), line.Times)
+	}
+
+	// GPX 1.0 keeps its name, description and author on the root
+	old, err := os.Open(author10gpx)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer old.Close()
+
+	results, err = DatasetFromGPX("", "", "", old, Options{Elevation: ConstantProvider{}})
+	if err != nil || results.Name != "Old survey" || attributeOf(results.Metadata, "author") != "J. Prospector <prospector@example.com>" || attributeOf(results.Metadata, "description") != "Converted from a handheld" {
+		t.Errorf("%s was %v, %v expected Old survey by J. Prospector\n", author10gpx, results, err)
+	}
+
+	// gpx is wgs84, a declared srs can only agree
+	old.Seek(0, 0)
+	if _, err := DatasetFromGPX("", "", "", old, Options{SRS: 32612, Elevation: ConstantProvider{}}); err == nil {
+		t.Errorf("a gpx declared in EPSG:32612 should be refused\n")
+	}
+}
+
+func TestGPXMissingElevation(t *testing.T) {
+
+	// a vertex without an ele is filled from the dem, not pinned to sea level
+	gpx := `<gpx version="1.1"><trk><trkseg><trkpt lat="34.07" lon="-112.17"><ele>500</ele></trkpt><trkpt lat="34.08" lon="-112.16"></trkpt></trkseg></trk></gpx>`
+
+	results, err := DatasetFromGPX("", "", "", strings.NewReader(gpx), Options{Elevation: ConstantProvider{Z: 1234}})
+	if err != nil {
+		t.Errorf("gpx conversion error: %v\n", err)
+		return
+	}
+
+	points := results.Lines[0].Points
+	if len(points) != 2 || points[0][2] != 500 || points[1][2] != 1234 {
+		t.Errorf("track was %v, expected z 500 as given then 1234 from the dem\n", points)
+	}
+}
+
+func TestGPXEllipsoidal(t *testing.T) {
+
+	// a phone track of ellipsoidal heights, 100m above the geoid sample's ground
+	geoidfile := "tests/geoid/egm96_sample.grd"
+	lon, lat := -112.17, 34.07
+	undulation := -30 + (lon + 360 - 247) + 2*(lat-33)
+	gpx := `<gpx version="1.1"><wpt lat="34.07" lon="-112.17"><ele>` + strconv.FormatFloat(100+undulation, 'f', -1, 64) + `</ele></wpt></gpx>`
+
+	// no srs needed, gpx is lon lat by spec
+	results, err := DatasetFromGPX("", "", "", strings.NewReader(gpx), Options{Elevation: ConstantProvider{}, ZDatum: Ellipsoidal, GeoidPath: geoidfile})
+	if err != nil {
+		t.Errorf("ellipsoidal gpx encountered %v\n", err)
+		return
+	}
+
+	if z := results.Points[0].Points[2]; math.Abs(z-100) > 0.01 {
+		t.Errorf("ellipsoidal height converted to %v, expected 100\n", z)
+	}
+}
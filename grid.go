@@ -0,0 +1,261 @@
+package convert
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Grid ... an in-memory elevation grid, eg a GeoTIFF, an Esri ASCII grid, or a test surface.
+// Rows run from the top (north) down, and cells hold NaN where there is no data.
+type Grid struct {
+	Cols   int
+	Rows   int
+	X0     float64   // left edge of the grid, in the grid's crs
+	Y0     float64   // top edge of the grid, in the grid's crs
+	DX     float64   // cell width
+	DY     float64   // cell height, positive
+	Values []float64 // row major, Rows * Cols
+	CRS    *CRS      // nil for EPSG:4326
+}
+
+// NewGrid returns a grid of values, see Grid
+func NewGrid(cols int, rows int, x0 float64, y0 float64, dx float64, dy float64, values []float64, crs *CRS) (*Grid, error) {
+	if cols < 1 || rows < 1 || dx <= 0 || dy <= 0 {
+		return nil, fmt.Errorf("invalid grid of %d x %d cells sized %v x %v", cols, rows, dx, dy)
+	}
+
+	if len(values) != cols*rows {
+		return nil, fmt.Errorf("grid of %d x %d cells has %d values", cols, rows, len(values))
+	}
+
+	return &Grid{Cols: cols, Rows: rows, X0: x0, Y0: y0, DX: dx, DY: dy, Values: values, CRS: crs}, nil
+}
+
+// fromLonLat takes a lon lat to the grid's crs
+func (g *Grid) fromLonLat(lon float64, lat float64) (float64, float64) {
+	if g.CRS == nil {
+		return lon, lat
+	}
+	return g.CRS.FromLonLat(lon, lat)
+}
+
+// cell returns the value at a column and row, NaN outside the grid
+func (g *Grid) cell(col int, row int) float64 {
+	if col < 0 || row < 0 || col >= g.Cols || row >= g.Rows {
+		return math.NaN()
+	}
+	return g.Values[row*g.Cols+col]
+}
+
+// ElevationAt ... see ElevationProvider, the value of the cell holding the lon lat
+func (g *Grid) ElevationAt(lon float64, lat float64) (float64, error) {
+	x, y := g.fromLonLat(lon, lat)
+
+	col := int(math.Floor((x - g.X0) / g.DX))
+	row := int(math.Floor((g.Y0 - y) / g.DY))
+
+	z := g.cell(col, row)
+	if math.IsNaN(z) {
+		return 0, errNoElevation
+	}
+	return z, nil
+}
+
+// ElevationsAt ... see ElevationProvider
+func (g *Grid) ElevationsAt(lonlats [][]float64) ([]float64, error) {
+	return elevationsAt(g, lonlats)
+}
+
+// Contains reports whether the grid has a value at the lon lat
+func (g *Grid) Contains(lon float64, lat float64) bool {
+	_, err := g.ElevationAt(lon, lat)
+	return err == nil
+}
+
+// spacing is the cell size in degrees, for sampling polygons
+func (g *Grid) spacing() float64 {
+	if g.CRS == nil || g.CRS.IsGeographic() {
+		return math.Min(g.DX, g.DY)
+	}
+
+	// roughly, meters to degrees of latitude
+	return math.Min(g.DX, g.DY) * g.CRS.toMeter() / 111320
+}
+
+// errGridFormat is returned for a grid file that can't be read
+var errGridFormat = errors.New("unsupported elevation grid")
+
+// ReadASCIIGrid reads an Esri ASCII grid (.asc) into a Grid.  The format carries no crs, so the
+// EPSG code of the grid is declared with srs, eg from its .prj.
+func ReadASCIIGrid(contents io.Reader, srs int) (*Grid, error) {
+	if srs == 0 {
+		return nil, errors.New("an ascii grid carries no crs, declare its srs")
+	}
+
+	crs, err := LookupEPSG(srs)
+	if err != nil {
+		return nil, err
+	}
+	if srs == 4326 {
+		crs = nil
+	}
+
+	scanner := bufio.NewScanner(contents)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	scanner.Split(bufio.ScanWords)
+
+	// the header is key value pairs, until the first number
+	header := make(map[string]float64)
+	var values []float64
+	for scanner.Scan() {
+		word := scanner.Text()
+		if v, err := strconv.ParseFloat(word, 64); err == nil {
+			values = append(values, v)
+			break
+		}
+
+		if !scanner.Scan() {
+			break
+		}
+		v, err := strconv.ParseFloat(scanner.Text(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v: ascii grid header %s %s", errGridFormat, word, scanner.Text())
+		}
+		header[strings.ToLower(word)] = v
+	}
+
+	for scanner.Scan() {
+		v, err := strconv.ParseFloat(scanner.Text(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v: ascii grid value %s", errGridFormat, scanner.Text())
+		}
+		values = append(values, v)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	cols, rows := int(header["ncols"]), int(header["nrows"])
+
+	dx, dy := header["cellsize"], header["cellsize"]
+	if _, ok := header["dx"]; ok {
+		dx, dy = header["dx"], header["dy"]
+	}
+
+	// the lower left is either a corner or a cell center
+	x0, ok := header["xllcorner"]
+	if !ok {
+		x0 = header["xllcenter"] - dx/2
+	}
+	yll, ok := header["yllcorner"]
+	if !ok {
+		yll = header["yllcenter"] - dy/2
+	}
+
+	if nodata, ok := header["nodata_value"]; ok {
+		for i, v := range values {
+			if v == nodata {
+				values[i] = math.NaN()
+			}
+		}
+	}
+
+	return NewGrid(cols, rows, x0, yll+float64(rows)*dy, dx, dy, values, crs)
+}
+
+// ReadDEM reads a GeoTIFF or an Esri ASCII grid, telling them apart by their first bytes
+// srs declares the crs of an ascii grid, a GeoTIFF carries its own
+func ReadDEM(contents io.Reader, srs int) (*Grid, error) {
+	r := bufio.NewReader(contents)
+
+	magic, err := r.Peek(4)
+	if err == io.EOF {
+		return nil, fmt.Errorf("%v: nothing to read, a reader is read once", errGridFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", errGridFormat, err)
+	}
+
+	switch string(magic) {
+	case "II*\x00", "MM\x00*":
+		return ReadGeoTIFF(r)
+	}
+	return ReadASCIIGrid(r, srs)
+}
+
+// FallbackProvider ... asks each provider in turn, eg a local drone DEM, then the world DEM
+type FallbackProvider struct {
+	Providers []ElevationProvider
+}
+
+// NewFallbackProvider returns a provider asking each of providers in turn
+func NewFallbackProvider(providers ...ElevationProvider) *FallbackProvider {
+	return &FallbackProvider{Providers: providers}
+}
+
+// ElevationAt ... see ElevationProvider, the first provider with an elevation wins
+func (p *FallbackProvider) ElevationAt(lon float64, lat float64) (float64, error) {
+	err := errNoElevation
+	for _, provider := range p.Providers {
+		var z float64
+		if z, err = provider.ElevationAt(lon, lat); err == nil {
+			return z, nil
+		}
+	}
+	return 0, err
+}
+
+// ElevationsAt ... see ElevationProvider, each provider fills what the ones before it could not
+func (p *FallbackProvider) ElevationsAt(lonlats [][]float64) ([]float64, error) {
+	zs := make([]float64, len(lonlats))
+	for i := range zs {
+		zs[i] = math.NaN()
+	}
+
+	missing := lonlats
+	index := make([]int, len(lonlats))
+	for i := range index {
+		index[i] = i
+	}
+
+	for _, provider := range p.Providers {
+		if len(missing) == 0 {
+			break
+		}
+
+		found, err := provider.ElevationsAt(missing)
+		if err != nil {
+			return nil, err
+		}
+
+		var stillMissing [][]float64
+		var stillIndex []int
+		for i, z := range found {
+			if math.IsNaN(z) {
+				stillMissing = append(stillMissing, missing[i])
+				stillIndex = append(stillIndex, index[i])
+				continue
+			}
+			zs[index[i]] = z
+		}
+		missing, index = stillMissing, stillIndex
+	}
+
+	return zs, nil
+}
+
+// spacing is the finest spacing of the providers, so the drape keeps the local detail
+func (p *FallbackProvider) spacing() float64 {
+	spacing := arcSecond
+	for _, provider := range p.Providers {
+		if s, ok := provider.(gridSpacing); ok {
+			spacing = math.Min(spacing, s.spacing())
+		}
+	}
+	return spacing
+}
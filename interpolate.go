@@ -0,0 +1,191 @@
+package convert
+
+import (
+	"fmt"
+	"math"
+)
+
+// Interpolation ... how elevations are read between DEM cell centers
+type Interpolation string
+
+const (
+	// Nearest takes the cell holding the point, stair stepping across cells
+	Nearest Interpolation = "nearest"
+
+	// Bilinear weights the four surrounding cell centers
+	Bilinear Interpolation = "bilinear"
+
+	// Bicubic fits a Catmull-Rom surface through the sixteen surrounding cell centers
+	Bicubic Interpolation = "bicubic"
+)
+
+// valid reports an error for an unknown interpolation
+func (mode Interpolation) valid() error {
+	switch mode {
+	case "", Nearest, Bilinear, Bicubic:
+		return nil
+	}
+	return fmt.Errorf("unknown interpolation %q, use nearest, bilinear or bicubic", mode)
+}
+
+// Interpolated returns the provider read with the interpolation.  A Grid is interpolated between
+// its own cells, other providers between lookups at the centers of their arc second cells.
+func Interpolated(provider ElevationProvider, mode Interpolation) ElevationProvider {
+	if mode == "" || mode == Nearest {
+		return provider
+	}
+
+	switch p := provider.(type) {
+	case ConstantProvider:
+		return p
+	case *Grid:
+		return &gridInterpolator{grid: p, mode: mode}
+	case *FallbackProvider:
+		var providers []ElevationProvider
+		for _, inner := range p.Providers {
+			providers = append(providers, Interpolated(inner, mode))
+		}
+		return NewFallbackProvider(providers...)
+	}
+
+	spacing := arcSecond
+	if p, ok := provider.(gridSpacing); ok {
+		spacing = p.spacing()
+	}
+	return &latticeInterpolator{provider: provider, mode: mode, cellSize: spacing}
+}
+
+// interpolate reads a surface at fractional cell fx, fy, where cell centers are whole numbers.
+// Cells without a value (NaN) drop bicubic to bilinear, and bilinear to nearest.
+func interpolate(mode Interpolation, fx float64, fy float64, value func(col int, row int) float64) float64 {
+	col, row := int(math.Floor(fx)), int(math.Floor(fy))
+	tx, ty := fx-float64(col), fy-float64(row)
+
+	if mode == Bicubic {
+		var rows [4]float64
+		for m := 0; m < 4; m++ {
+			var p [4]float64
+			for n := 0; n < 4; n++ {
+				p[n] = value(col-1+n, row-1+m)
+			}
+			rows[m] = catmullRom(p, tx)
+		}
+
+		if z := catmullRom(rows, ty); !math.IsNaN(z) {
+			return z
+		}
+	}
+
+	if mode == Bicubic || mode == Bilinear {
+		top := value(col, row)*(1-tx) + value(col+1, row)*tx
+		bottom := value(col, row+1)*(1-tx) + value(col+1, row+1)*tx
+
+		if z := top*(1-ty) + bottom*ty; !math.IsNaN(z) {
+			return z
+		}
+	}
+
+	return value(int(math.Round(fx)), int(math.Round(fy)))
+}
+
+// catmullRom interpolates between p[1] and p[2] at t
+func catmullRom(p [4]float64, t float64) float64 {
+	return p[1] + 0.5*t*(p[2]-p[0]+t*(2*p[0]-5*p[1]+4*p[2]-p[3]+t*(3*(p[1]-p[2])+p[3]-p[0])))
+}
+
+// gridInterpolator ... a Grid read with an interpolation
+type gridInterpolator struct {
+	grid *Grid
+	mode Interpolation
+}
+
+// ElevationAt ... see ElevationProvider
+func (p *gridInterpolator) ElevationAt(lon float64, lat float64) (float64, error) {
+	x, y := p.grid.fromLonLat(lon, lat)
+
+	// fractional cells, from the center of the top left cell
+	fx := (x-p.grid.X0)/p.grid.DX - 0.5
+	fy := (p.grid.Y0-y)/p.grid.DY - 0.5
+
+	z := interpolate(p.mode, fx, fy, p.grid.cell)
+	if math.IsNaN(z) {
+		return 0, errNoElevation
+	}
+	return z, nil
+}
+
+// ElevationsAt ... see ElevationProvider
+func (p *gridInterpolator) ElevationsAt(lonlats [][]float64) ([]float64, error) {
+	return elevationsAt(p, lonlats)
+}
+
+// spacing is the grid's
+func (p *gridInterpolator) spacing() float64 {
+	return p.grid.spacing()
+}
+
+// latticeInterpolator ... a provider read at the centers of its cells, on a lon lat lattice
+// aligned to whole degrees as srtm is, and interpolated between them
+type latticeInterpolator struct {
+	provider ElevationProvider
+	mode     Interpolation
+	cellSize float64
+}
+
+// ElevationAt ... see ElevationProvider
+func (p *latticeInterpolator) ElevationAt(lon float64, lat float64) (float64, error) {
+	zs, err := p.ElevationsAt([][]float64{{lon, lat}})
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(zs[0]) {
+		return 0, errNoElevation
+	}
+	return zs[0], nil
+}
+
+// ElevationsAt ... see ElevationProvider, every cell center needed goes to the provider in one batch
+func (p *latticeInterpolator) ElevationsAt(lonlats [][]float64) ([]float64, error) {
+	lo, hi := 0, 1
+	if p.mode == Bicubic {
+		lo, hi = -1, 2
+	}
+
+	// the cell centers around every lon lat, once each
+	index := make(map[[2]int]int)
+	var centers [][]float64
+	for _, lonlat := range lonlats {
+		col, row := int(math.Floor(lonlat[0]/p.cellSize)), int(math.Floor(lonlat[1]/p.cellSize))
+		for j := row + lo; j <= row+hi; j++ {
+			for i := col + lo; i <= col+hi; i++ {
+				if _, ok := index[[2]int{i, j}]; !ok {
+					index[[2]int{i, j}] = len(centers)
+					centers = append(centers, []float64{float64(i) * p.cellSize, float64(j) * p.cellSize})
+				}
+			}
+		}
+	}
+
+	found, err := p.provider.ElevationsAt(centers)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func(col int, row int) float64 {
+		if i, ok := index[[2]int{col, row}]; ok {
+			return found[i]
+		}
+		return math.NaN()
+	}
+
+	zs := make([]float64, len(lonlats))
+	for i, lonlat := range lonlats {
+		zs[i] = interpolate(p.mode, lonlat[0]/p.cellSize, lonlat[1]/p.cellSize, value)
+	}
+	return zs, nil
+}
+
+// spacing is the lattice's
+func (p *latticeInterpolator) spacing() float64 {
+	return p.cellSize
+}
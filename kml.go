@@ -0,0 +1,538 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// kmlContainer ... the kml root, a Document or a Folder, holding placemarks and nested containers
+type kmlContainer struct {
+	Name       string         `xml:"name"`
+	Schemas    []kmlSchema    `xml:"Schema"`
+	Styles     []kmlStyle     `xml:"Style"`
+	StyleMaps  []kmlStyleMap  `xml:"StyleMap"`
+	Documents  []kmlContainer `xml:"Document"`
+	Folders    []kmlContainer `xml:"Folder"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+// kmlPlacemark ... a kml feature, its geometries and its attributes
+type kmlPlacemark struct {
+	Name        string          `xml:"name"`
+	Description string          `xml:"description"`
+	StyleURL    string          `xml:"styleUrl"`
+	Style       *kmlStyle       `xml:"Style"`
+	SchemaData  []kmlSchemaData `xml:"ExtendedData>SchemaData"`
+	Data        []kmlData       `xml:"ExtendedData>Data"`
+
+	kmlGeometries
+}
+
+// kmlGeometries ... the geometries of a Placemark or a MultiGeometry, which may nest
+type kmlGeometries struct {
+	Points          []kmlPath       `xml:"Point"`
+	LineStrings     []kmlPath       `xml:"LineString"`
+	LinearRings     []kmlPath       `xml:"LinearRing"`
+	Polygons        []kmlPolygon    `xml:"Polygon"`
+	MultiGeometries []kmlGeometries `xml:"MultiGeometry"`
+}
+
+// kmlSchema ... the fields of typed attributes, SimpleData, in order
+type kmlSchema struct {
+	ID     string `xml:"id,attr"`
+	Name   string `xml:"name,attr"`
+	Fields []struct {
+		Name string `xml:"name,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"SimpleField"`
+}
+
+// kmlSchemaData ... the typed attributes of a placemark, of the schema at schemaUrl
+type kmlSchemaData struct {
+	SchemaURL  string          `xml:"schemaUrl,attr"`
+	SimpleData []kmlSimpleData `xml:"SimpleData"`
+}
+
+// kmlSimpleData ... a typed attribute of a placemark
+type kmlSimpleData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+// kmlData ... an untyped attribute of a placemark
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+// kmlStyle ... the look of placemarks, shared by its id or inline in a placemark.  Fields are
+// empty where they aren't set.
+type kmlStyle struct {
+	ID string `xml:"id,attr"`
+
+	IconStyle struct {
+		Color string `xml:"color"`
+		Scale string `xml:"scale"`
+		Href  string `xml:"Icon>href"`
+	} `xml:"IconStyle"`
+
+	LineStyle struct {
+		Color string `xml:"color"`
+		Width string `xml:"width"`
+	} `xml:"LineStyle"`
+
+	PolyStyle struct {
+		Color   string `xml:"color"`
+		Fill    string `xml:"fill"`
+		Outline string `xml:"outline"`
+	} `xml:"PolyStyle"`
+}
+
+// kmlStyleMap ... the styles of a placemark by its state, normal or highlight
+type kmlStyleMap struct {
+	ID    string `xml:"id,attr"`
+	Pairs []struct {
+		Key      string    `xml:"key"`
+		StyleURL string    `xml:"styleUrl"`
+		Style    *kmlStyle `xml:"Style"`
+	} `xml:"Pair"`
+}
+
+// kmlShared ... the shared styles, style maps and schemas of a document, by id
+type kmlShared struct {
+	styles    map[string]*kmlStyle
+	styleMaps map[string]*kmlStyleMap
+	schemas   map[string]*kmlSchema
+}
+
+// kmlPath ... the coordinates of a Point, LineString or LinearRing
+type kmlPath struct {
+	Coordinates kmlCoordinates `xml:"coordinates"`
+}
+
+// kmlPolygon ... an outer boundary and its holes, one LinearRing per innerBoundaryIs, or several
+type kmlPolygon struct {
+	OuterBoundary   kmlCoordinates   `xml:"outerBoundaryIs>LinearRing>coordinates"`
+	InnerBoundaries []kmlCoordinates `xml:"innerBoundaryIs>LinearRing>coordinates"`
+}
+
+// kmlCoordinates ... a kml coordinates element, lon,lat[,alt] tuples separated by whitespace
+type kmlCoordinates string
+
+// decodeKML reads a kml document from its root.  A truncated or malformed document keeps the
+// placemarks read before the error, if there are any.
+func decodeKML(contents io.Reader) (*kmlContainer, error) {
+	var root kmlContainer
+	if err := xml.NewDecoder(contents).Decode(&root); err != nil {
+		placemarks := 0
+		root.walk("", func(*kmlPlacemark, string) { placemarks++ })
+		if placemarks == 0 {
+			return nil, fmt.Errorf("unreadable kml: %v", err)
+		}
+
+		fmt.Printf("Warning: [decodeKML] in pkg [convert] kept %d placemarks of a kml that encountered: %v\n", placemarks, err)
+	}
+	return &root, nil
+}
+
+// dataset is the container that stands for the whole dataset, the sole Document of the root
+// and then its sole Folder, if they hold nothing else
+func (container *kmlContainer) dataset() *kmlContainer {
+	for {
+		switch {
+		case len(container.Documents) == 1 && len(container.Folders) == 0 && len(container.Placemarks) == 0:
+			container = &container.Documents[0]
+		case len(container.Folders) == 1 && len(container.Documents) == 0 && len(container.Placemarks) == 0:
+			container = &container.Folders[0]
+		default:
+			return container
+		}
+	}
+}
+
+// walk visits every placemark of the container and its nested Documents and Folders, depth
+// first, with the path of container names down to it, eg "Claims/2021"
+func (container *kmlContainer) walk(path string, visit func(placemark *kmlPlacemark, path string)) {
+	for i := range container.Placemarks {
+		visit(&container.Placemarks[i], path)
+	}
+
+	for _, children := range [][]kmlContainer{container.Documents, container.Folders} {
+		for i := range children {
+			child := &children[i]
+
+			childPath := path
+			if name := strings.TrimSpace(child.Name); name != "" {
+				childPath = strings.TrimPrefix(path+"/"+name, "/")
+			}
+			child.walk(childPath, visit)
+		}
+	}
+}
+
+// shared gathers the shared styles, style maps and schemas of the container and its nested
+// containers.  A schema is known by its id and, as older files refer to it, its name.
+func (container *kmlContainer) shared() *kmlShared {
+	shared := &kmlShared{styles: make(map[string]*kmlStyle), styleMaps: make(map[string]*kmlStyleMap), schemas: make(map[string]*kmlSchema)}
+
+	var gather func(container *kmlContainer)
+	gather = func(container *kmlContainer) {
+		for i := range container.Styles {
+			shared.styles[container.Styles[i].ID] = &container.Styles[i]
+		}
+		for i := range container.StyleMaps {
+			shared.styleMaps[container.StyleMaps[i].ID] = &container.StyleMaps[i]
+		}
+		for i := range container.Schemas {
+			schema := &container.Schemas[i]
+			for _, key := range []string{schema.Name, schema.ID} {
+				if key != "" {
+					shared.schemas[key] = schema
+				}
+			}
+		}
+
+		for _, children := range [][]kmlContainer{container.Documents, container.Folders} {
+			for i := range children {
+				gather(&children[i])
+			}
+		}
+	}
+	gather(container)
+
+	return shared
+}
+
+// resolve finds the style of a styleUrl, following a style map to its normal style.  Only the
+// styles of the document itself, #id, are known.  The id is that of the style or style map.
+func (styles *kmlShared) resolve(url string, depth int) (kmlStyle, string) {
+	id := strings.TrimSpace(url)
+	if !strings.HasPrefix(id, "#") || depth > 8 {
+		return kmlStyle{}, ""
+	}
+	id = id[1:]
+
+	if style, ok := styles.styles[id]; ok {
+		return *style, id
+	}
+
+	if styleMap, ok := styles.styleMaps[id]; ok {
+		for _, pair := range styleMap.Pairs {
+			if strings.TrimSpace(pair.Key) != "normal" {
+				continue
+			}
+
+			style, _ := styles.resolve(pair.StyleURL, depth+1)
+			if pair.Style != nil {
+				style = style.merge(pair.Style)
+			}
+			return style, id
+		}
+	}
+
+	return kmlStyle{}, ""
+}
+
+// merge overrides the fields of the style with those set in inline
+func (style kmlStyle) merge(inline *kmlStyle) kmlStyle {
+	for _, field := range [][2]*string{
+		{&style.IconStyle.Color, &inline.IconStyle.Color},
+		{&style.IconStyle.Scale, &inline.IconStyle.Scale},
+		{&style.IconStyle.Href, &inline.IconStyle.Href},
+		{&style.LineStyle.Color, &inline.LineStyle.Color},
+		{&style.LineStyle.Width, &inline.LineStyle.Width},
+		{&style.PolyStyle.Color, &inline.PolyStyle.Color},
+		{&style.PolyStyle.Fill, &inline.PolyStyle.Fill},
+		{&style.PolyStyle.Outline, &inline.PolyStyle.Outline},
+	} {
+		if value := strings.TrimSpace(*field[1]); value != "" {
+			*field[0] = value
+		}
+	}
+	return style
+}
+
+// attributes are the style fields that apply to a feature of the kind, a point's icon, a line's
+// line, and a shape's fill and outline, with colors as #rrggbbaa
+func (style kmlStyle) attributes(kind string) []Attribute {
+	var fields [][2]string
+	switch kind {
+	case "point":
+		fields = [][2]string{{"icon", style.IconStyle.Href}, {"iconcolor", kmlColor(style.IconStyle.Color)}, {"iconscale", style.IconStyle.Scale}}
+	case "line":
+		fields = [][2]string{{"linecolor", kmlColor(style.LineStyle.Color)}, {"linewidth", style.LineStyle.Width}}
+	case "shape":
+		fields = [][2]string{{"fillcolor", kmlColor(style.PolyStyle.Color)}, {"fill", kmlBool(style.PolyStyle.Fill)}, {"outline", kmlBool(style.PolyStyle.Outline)},
+			{"linecolor", kmlColor(style.LineStyle.Color)}, {"linewidth", style.LineStyle.Width}}
+	}
+
+	var attributes []Attribute
+	for _, field := range fields {
+		if value := strings.TrimSpace(field[1]); value != "" {
+			attributes = append(attributes, Attribute{Key: field[0], Value: value})
+		}
+	}
+	return attributes
+}
+
+// kmlColor turns a kml color, aabbggrr in hex, into #rrggbbaa as Unity parses it
+func kmlColor(color string) string {
+	color = strings.TrimPrefix(strings.TrimSpace(color), "#")
+	if len(color) != 8 {
+		return color
+	}
+	return "#" + strings.ToLower(color[6:8]+color[4:6]+color[2:4]+color[0:2])
+}
+
+// kmlBool turns a kml boolean, 0 or 1, into false or true
+func kmlBool(value string) string {
+	switch strings.TrimSpace(value) {
+	case "0", "false":
+		return "false"
+	case "1", "true":
+		return "true"
+	}
+	return ""
+}
+
+// parse reads the coordinate tuples, an altitude is kept when there is one
+func (coordinates kmlCoordinates) parse() ([][]float64, error) {
+	var coords [][]float64
+	for _, tuple := range strings.Fields(string(coordinates)) {
+		var coord []float64
+		for _, ordinate := range strings.Split(tuple, ",") {
+			v, err := strconv.ParseFloat(ordinate, 64)
+			if err != nil {
+				return nil, fmt.Errorf("kml coordinate %q: %v", tuple, err)
+			}
+			coord = append(coord, v)
+		}
+
+		if len(coord) < 2 || len(coord) > 3 {
+			return nil, fmt.Errorf("kml coordinate %q", tuple)
+		}
+		coords = append(coords, coord)
+	}
+	return coords, nil
+}
+
+// geometries flattens the geometries, and those of nested MultiGeometry, to geojson.  A
+// LinearRing on its own is a line, and a polygon with holes is a multipolygon of one, so it gets
+// the hole aware drape of ParseGEOJSONFeature.
+func (g *kmlGeometries) geometries() ([]*geojson.Geometry, error) {
+	var geometries []*geojson.Geometry
+
+	for _, point := range g.Points {
+		coords, err := point.Coordinates.parse()
+		if err == nil && len(coords) != 1 {
+			err = fmt.Errorf("a point of %d coordinates", len(coords))
+		}
+		if err != nil {
+			return nil, err
+		}
+		geometries = append(geometries, geojson.NewPointGeometry(coords[0]))
+	}
+
+	for _, line := range append(g.LineStrings, g.LinearRings...) {
+		coords, err := line.Coordinates.parse()
+		if err == nil && len(coords) < 2 {
+			err = fmt.Errorf("a line of %d coordinates", len(coords))
+		}
+		if err != nil {
+			return nil, err
+		}
+		geometries = append(geometries, geojson.NewLineStringGeometry(coords))
+	}
+
+	for _, polygon := range g.Polygons {
+		var rings [][][]float64
+		for _, boundary := range append([]kmlCoordinates{polygon.OuterBoundary}, polygon.InnerBoundaries...) {
+			ring, err := boundary.parse()
+			if err == nil && len(ring) < 3 {
+				err = fmt.Errorf("a polygon ring of %d coordinates", len(ring))
+			}
+			if err != nil {
+				return nil, err
+			}
+			rings = append(rings, ring)
+		}
+
+		if len(rings) > 1 {
+			geometries = append(geometries, geojson.NewMultiPolygonGeometry(rings))
+			continue
+		}
+		geometries = append(geometries, geojson.NewPolygonGeometry(rings))
+	}
+
+	for i := range g.MultiGeometries {
+		members, err := g.MultiGeometries[i].geometries()
+		if err != nil {
+			return nil, err
+		}
+		geometries = append(geometries, members...)
+	}
+
+	return geometries, nil
+}
+
+// attributes are the placemark's SimpleData, in the order of their schema's fields, booleans as
+// true / false, then its Data, then the key / value rows of its description, or else its text.
+// The first of a key is kept.
+func (record *kmlPlacemark) attributes(shared *kmlShared) []Attribute {
+	var attributes []Attribute
+	seen := make(map[string]bool)
+	add := func(key string, value string) {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		attributes = append(attributes, Attribute{Key: key, Value: strings.TrimSpace(value)})
+	}
+
+	for _, data := range record.SchemaData {
+		if schema, ok := shared.schemas[strings.TrimPrefix(strings.TrimSpace(data.SchemaURL), "#")]; ok {
+			values := make(map[string]string)
+			for _, simple := range data.SimpleData {
+				if _, ok := values[simple.Name]; !ok {
+					values[simple.Name] = simple.Value
+				}
+			}
+
+			for _, field := range schema.Fields {
+				value, ok := values[field.Name]
+				if !ok {
+					continue
+				}
+				if field.Type == "bool" && kmlBool(value) != "" {
+					value = kmlBool(value)
+				}
+				add(field.Name, value)
+			}
+		}
+
+		// and those the schema doesn't declare
+		for _, simple := range data.SimpleData {
+			add(simple.Name, simple.Value)
+		}
+	}
+
+	for _, data := range record.Data {
+		add(data.Name, data.Value)
+	}
+
+	rows, text := kmlDescription(record.Description)
+	for _, row := range rows {
+		add(row[0], row[1])
+	}
+	if len(rows) == 0 && text != "" {
+		add("description", text)
+	}
+
+	return attributes
+}
+
+// htmlCell matches a table cell of html, its contents
+var htmlCell = regexp.MustCompile(`(?is)<t[dh]\b[^>]*>(.*?)</t[dh]\s*>`)
+
+// htmlTag matches an html tag
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// kmlDescription reads the key / value rows of the html tables of a description balloon, rows
+// of two cells without tables nested in them, eg the popups of ArcGIS and QGIS, and its text.
+// Empty values are dropped, as are the <Null> of ArcGIS.
+func kmlDescription(description string) ([][2]string, string) {
+	// ascii lowercase, so the offsets are those of the description
+	lower := []byte(description)
+	for i, c := range lower {
+		if 'A' <= c && c <= 'Z' {
+			lower[i] = c + 'a' - 'A'
+		}
+	}
+
+	var rows [][2]string
+	for position := 0; ; {
+		end := bytes.Index(lower[position:], []byte("</tr"))
+		if end < 0 {
+			break
+		}
+		end += position
+
+		// the innermost row that this closes
+		if start := bytes.LastIndex(lower[position:end], []byte("<tr")); start >= 0 {
+			cells := htmlCell.FindAllStringSubmatch(description[position+start:end], -1)
+			if len(cells) == 2 {
+				key := strings.TrimSuffix(htmlText(cells[0][1]), ":")
+				if value := htmlText(cells[1][1]); key != "" && value != "" && value != "<Null>" {
+					rows = append(rows, [2]string{key, value})
+				}
+			}
+		}
+		position = end + len("</tr")
+	}
+
+	return rows, htmlText(description)
+}
+
+// htmlText is the text of html, without its tags, its entities unescaped and its whitespace
+// collapsed
+func htmlText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(htmlTag.ReplaceAllString(s, " "))), " ")
+}
+
+// parseKMLPlacemark converts a placemark to features, its folder path as the folder attribute.
+// Its geometries are parsed as geojson features would be, then given its name, attributes and
+// style, the shared style's id as the StyleType.
+func parseKMLPlacemark(record *kmlPlacemark, folder string, shared *kmlShared, outdataset *Datasets, container *ExtentContainer) {
+
+	// parse Attributes
+	attributes := record.attributes(shared)
+
+	if folder != "" {
+		attributes = append(attributes, Attribute{Key: "folder", Value: folder})
+	}
+
+	geometries, err := record.geometries()
+	if err != nil {
+		fmt.Printf("NonFatal [DatasetFromKML] placemark %s encountered %v\n", record.Name, err.Error())
+		return
+	}
+
+	style, styleType := shared.resolve(record.StyleURL, 0)
+	if record.Style != nil {
+		style = style.merge(record.Style)
+	}
+
+	points, lines, shapes := len(outdataset.Points), len(outdataset.Lines), len(outdataset.Shapes)
+
+	for _, geometry := range geometries {
+		gfeature := FeatureInfo{Geojson: *geojson.NewFeature(geometry)}
+		if err := ParseGEOJSONFeature(&gfeature, outdataset, container); err != nil {
+			fmt.Printf("NonFatal [DatasetFromKML] %s of placemark %s encountered %v\n", geometry.Type, record.Name, err.Error())
+		}
+	}
+
+	for i := points; i < len(outdataset.Points); i++ {
+		feature := &outdataset.Points[i]
+		feature.Name, feature.StyleType = record.Name, styleType
+		feature.Attributes = append(append([]Attribute(nil), attributes...), style.attributes("point")...)
+	}
+	for i := lines; i < len(outdataset.Lines); i++ {
+		feature := &outdataset.Lines[i]
+		feature.Name, feature.StyleType = record.Name, styleType
+		feature.Attributes = append(append([]Attribute(nil), attributes...), style.attributes("line")...)
+	}
+	for i := shapes; i < len(outdataset.Shapes); i++ {
+		feature := &outdataset.Shapes[i]
+		feature.Name, feature.StyleType = record.Name, styleType
+		feature.Attributes = append(append([]Attribute(nil), attributes...), style.attributes("shape")...)
+	}
+}
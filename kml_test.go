@@ -0,0 +1,308 @@
+package convert
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"testing"
+)
+
+const (
+	//kml and kmz testing datasets
+	projectkml    = "tests/kml/project.kml"
+	geometrieskml = "tests/kml/geometries.kml"
+	styleskml     = "tests/kml/styles.kml"
+	extendedkml   = "tests/kml/extendeddata.kml"
+	sitekmz       = "tests/kmz/site.kmz"
+)
+
+func TestKMLFolders(t *testing.T) {
+
+	data, err := os.Open(projectkml)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer data.Close()
+
+	results, err := DatasetFromKML("", "", "", data, Options{Elevation: ConstantProvider{Z: 1234}})
+	if err != nil {
+		t.Errorf("kml conversion error for %s: %v\n", projectkml, err)
+		return
+	}
+
+	if results.Name != "Exploration 2023" {
+		t.Errorf("%s was named %q, expected Exploration 2023\n", projectkml, results.Name)
+	}
+
+	// placemarks under the document, nested and sibling folders, and a nested document
+	folders := make(map[string]string)
+	for _, point := range results.Points {
+		folders[point.Name] = folderOf(point.Attributes)
+	}
+	for _, line := range results.Lines {
+		folders[line.Name] = folderOf(line.Attributes)
+	}
+	for _, shape := range results.Shapes {
+		folders[shape.Name] = folderOf(shape.Attributes)
+	}
+
+	want := map[string]string{"Camp": "", "Claim A": "Claims/2021", "Claim B": "Claims/2022", "Haul road": "Roads", "Old collar": "Imported"}
+	if len(folders) != len(want) {
+		t.Errorf("%s placemarks were %v, expected %v\n", projectkml, folders, want)
+	}
+	for name, folder := range want {
+		if got, ok := folders[name]; !ok || got != folder {
+			t.Errorf("%s placemark %s was in folder %q, expected %q\n", projectkml, name, got, folder)
+		}
+	}
+
+	// a document of one folder is the folder, as it always was
+	legacy, err := os.Open(pointskml)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer legacy.Close()
+
+	results, err = DatasetFromKML("", "", "", legacy, Options{Elevation: ConstantProvider{}})
+	if err != nil || results.Name != "Keno_250_West_Points_kml_only" || len(results.Points) != 2936 {
+		t.Errorf("%s was %v, expected 2936 points of Keno_250_West_Points_kml_only\n", pointskml, err)
+		return
+	}
+	if folder := folderOf(results.Points[0].Attributes); folder != "" {
+		t.Errorf("%s points were in folder %q, expected none\n", pointskml, folder)
+	}
+}
+
+// folderOf is the folder attribute of a feature
+func folderOf(attributes []Attribute) string {
+	return attributeOf(attributes, "folder")
+}
+
+// attributeOf is the value of an attribute of a feature, empty if it has none
+func attributeOf(attributes []Attribute, key string) string {
+	for _, att := range attributes {
+		if att.Key == key {
+			return att.Value
+		}
+	}
+	return ""
+}
+
+func TestKMZ(t *testing.T) {
+
+	data, err := os.Open(sitekmz)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer data.Close()
+
+	results, err := DatasetFromKMZ(data, Options{Elevation: ConstantProvider{}})
+	if err != nil {
+		t.Errorf("kmz conversion error for %s: %v\n", sitekmz, err)
+		return
+	}
+
+	// the icon and the overlay image, not the kml, its folder, or the macos resource fork
+	want := map[string]string{"files/collar.png": "image/png", "files/pit.jpg": "image/jpeg"}
+	if len(results.Resources) != len(want) {
+		t.Errorf("%s had resources %v, expected %v\n", sitekmz, results.Resources, want)
+		return
+	}
+	for _, resource := range results.Resources {
+		if want[resource.Path] != resource.MediaType || len(resource.Data) == 0 {
+			t.Errorf("%s resource %s was %s of %d bytes, expected %s\n", sitekmz, resource.Path, resource.MediaType, len(resource.Data), want[resource.Path])
+		}
+	}
+
+	// the icon of the point's style is one of the resources
+	if len(results.Points) != 1 || results.Points[0].StyleType != "collar" || attributeOf(results.Points[0].Attributes, "icon") != "files/collar.png" {
+		t.Errorf("%s points were %v, expected one styled collar with its icon\n", sitekmz, results.Points)
+	}
+
+	// a zip without a kml is no kmz
+	var empty bytes.Buffer
+	archive := zip.NewWriter(&empty)
+	w, _ := archive.Create("files/collar.png")
+	w.Write([]byte("png"))
+	archive.Close()
+
+	if _, err := DatasetFromKMZ(&empty, Options{Elevation: ConstantProvider{}}); err == nil {
+		t.Errorf("a kmz without a kml should be refused\n")
+	}
+}
+
+func TestKMLGeometries(t *testing.T) {
+
+	data, err := os.Open(geometrieskml)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer data.Close()
+
+	results, err := DatasetFromKML("", "", "", data, Options{Elevation: ConstantProvider{Z: 1234}})
+	if err != nil {
+		t.Errorf("kml conversion error for %s: %v\n", geometrieskml, err)
+		return
+	}
+
+	// bare geometries, and every child of a nested multigeometry, a linearring as a line
+	names := make(map[string]int)
+	for _, point := range results.Points {
+		names["point "+point.Name]++
+	}
+	for _, line := range results.Lines {
+		names["line "+line.Name]++
+	}
+	for _, shape := range results.Shapes {
+		names["shape "+shape.Name]++
+	}
+
+	want := map[string]int{"point Collar": 1, "line Fence": 1, "shape Lease": 1, "shape Pad": 1, "line Powerline": 3, "point Powerline": 1}
+	if len(names) != len(want) {
+		t.Errorf("%s features were %v, expected %v\n", geometrieskml, names, want)
+	}
+	for name, count := range want {
+		if names[name] != count {
+			t.Errorf("%s had %d of %s, expected %d\n", geometrieskml, names[name], name, count)
+		}
+	}
+
+	for _, shape := range results.Shapes {
+		switch shape.Name {
+		case "Pad":
+			// with z, the outer boundary and both holes
+			if len(shape.Points) != 1 || len(shape.Points[0]) != 3 {
+				t.Errorf("pad rings were %v, expected an outer boundary and two holes\n", shape.Points)
+			}
+
+		case "Lease":
+			// without z, a drape without triangles in the hole
+			if len(shape.Vertices) == 0 || len(shape.Indices) == 0 {
+				t.Errorf("lease was not draped, %d vertices\n", len(shape.Vertices))
+				continue
+			}
+
+			hole := [][][]float64{{{-114.51, 34.09}, {-114.49, 34.09}, {-114.49, 34.11}, {-114.51, 34.11}, {-114.51, 34.09}}}
+			for i := 0; i+2 < len(shape.Indices); i += 3 {
+				var cx, cy float64
+				for _, index := range shape.Indices[i : i+3] {
+					lon, lat := webMercatorTo4326(shape.Vertices[index][0], shape.Vertices[index][1])
+					cx, cy = cx+lon/3, cy+lat/3
+				}
+				if cx > -114.5099 && cx < -114.4901 && cy > 34.0901 && cy < 34.1099 {
+					t.Errorf("lease triangle %d centered at %v %v is in the hole %v\n", i/3, cx, cy, hole)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestKMLStyles(t *testing.T) {
+
+	data, err := os.Open(styleskml)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer data.Close()
+
+	results, err := DatasetFromKML("", "", "", data, Options{Elevation: ConstantProvider{}})
+	if err != nil {
+		t.Errorf("kml conversion error for %s: %v\n", styleskml, err)
+		return
+	}
+
+	if len(results.Points) != 2 || len(results.Lines) != 1 || len(results.Shapes) != 1 {
+		t.Errorf("%s had %d points, %d lines and %d shapes, expected 2, 1 and 1\n", styleskml, len(results.Points), len(results.Lines), len(results.Shapes))
+		return
+	}
+
+	tests := []struct {
+		feature    string
+		styleType  string
+		got        string
+		attributes []Attribute
+		want       map[string]string
+	}{
+		// a style map's normal style, with the inline width over the shared one
+		{"Claim A", "claim", results.Shapes[0].StyleType, results.Shapes[0].Attributes,
+			map[string]string{"fillcolor": "#00ff007f", "fill": "true", "outline": "true", "linecolor": "#ff0000ff", "linewidth": "4"}},
+		// a shared style of a folder, the icon of a point
+		{"Outcrop 7", "outcrop", results.Points[0].StyleType, results.Points[0].Attributes,
+			map[string]string{"folder": "Field", "icon": "files/outcrop.png", "iconcolor": "#ffaa00ff", "iconscale": "1.2"}},
+		// an inline style alone has no style type
+		{"Traverse", "", results.Lines[0].StyleType, results.Lines[0].Attributes,
+			map[string]string{"folder": "Field", "linecolor": "#ffff00ff", "linewidth": "3"}},
+		// another document's style is unknown
+		{"Elsewhere", "", results.Points[1].StyleType, results.Points[1].Attributes, map[string]string{"folder": "Field"}},
+	}
+
+	for _, test := range tests {
+		if test.got != test.styleType {
+			t.Errorf("%s style type was %q, expected %q\n", test.feature, test.got, test.styleType)
+		}
+		if len(test.attributes) != len(test.want) {
+			t.Errorf("%s style attributes were %v, expected %v\n", test.feature, test.attributes, test.want)
+			continue
+		}
+		for key, value := range test.want {
+			if got := attributeOf(test.attributes, key); got != value {
+				t.Errorf("%s %s was %q, expected %q\n", test.feature, key, got, value)
+			}
+		}
+	}
+}
+
+func TestKMLExtendedData(t *testing.T) {
+
+	data, err := os.Open(extendedkml)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer data.Close()
+
+	results, err := DatasetFromKML("", "", "", data, Options{Elevation: ConstantProvider{}})
+	if err != nil {
+		t.Errorf("kml conversion error for %s: %v\n", extendedkml, err)
+		return
+	}
+
+	if len(results.Points) != 1 || len(results.Lines) != 1 {
+		t.Errorf("%s had %d points and %d lines, expected 1 of each\n", extendedkml, len(results.Points), len(results.Lines))
+		return
+	}
+
+	// simple data in the order of the schema, then data, then the rows of the description's
+	// nested table, the first of a key kept, empty and <Null> values dropped
+	want := []Attribute{
+		{Key: "HOLE_ID", Value: "DH-001"},
+		{Key: "DEPTH", Value: "152.4"},
+		{Key: "LOGGED", Value: "true"},
+		{Key: "RIG", Value: "RC-2"},
+		{Key: "geologist", Value: "J. Smith"},
+		{Key: "Lithology", Value: "Basalt"},
+		{Key: "Alteration", Value: "Propylitic"},
+	}
+
+	attributes := results.Points[0].Attributes
+	if len(attributes) != len(want) {
+		t.Errorf("%s point attributes were %v, expected %v\n", extendedkml, attributes, want)
+		return
+	}
+	for i, att := range want {
+		if attributes[i] != att {
+			t.Errorf("%s point attribute %d was %v, expected %v\n", extendedkml, i, attributes[i], att)
+		}
+	}
+
+	// a description without a table is kept as text
+	if description := attributeOf(results.Lines[0].Attributes, "description"); description != "Old trench, see the 1987 log & photos" {
+		t.Errorf("%s line description was %q\n", extendedkml, description)
+	}
+}
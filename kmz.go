@@ -0,0 +1,102 @@
+package convert
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"path"
+	"strings"
+)
+
+// DatasetFromKMZ converts a kmz, the zipped kml of Google Earth, with its embedded icons and
+// overlay images as the dataset's Resources, by their paths in the zip as the kml refers to them.
+// The srs is that of DatasetFromKML.
+func DatasetFromKMZ(contents io.Reader, opts ...Options) (*Datasets, error) {
+	raw, err := ioutil.ReadAll(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("[DatasetFromKMZ] in pkg [convert] encountered: %v", err)
+	}
+
+	doc := kmzDocument(archive.File)
+	if doc == nil {
+		return nil, errors.New("no .kml in the kmz")
+	}
+
+	var resources []Resource
+	for _, f := range archive.File {
+		// skip folders, the kml itself, and the resource forks of macos zips
+		if f == doc || f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(path.Base(f.Name), ".") {
+			continue
+		}
+
+		data, err := readZipFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("kmz resource %s: %v", f.Name, err)
+		}
+
+		resources = append(resources, Resource{
+			Path:      f.Name,
+			MediaType: mime.TypeByExtension(strings.ToLower(path.Ext(f.Name))),
+			Data:      data,
+		})
+	}
+
+	kml, err := readZipFile(doc)
+	if err != nil {
+		return nil, fmt.Errorf("kmz %s: %v", doc.Name, err)
+	}
+
+	outdataset, err := DatasetFromKML("", "", "", bytes.NewReader(kml), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	outdataset.Resources = resources
+
+	return outdataset, nil
+}
+
+// kmzDocument finds the kml of a kmz, doc.kml by convention, otherwise the first kml at the
+// root of the zip, otherwise the first kml anywhere
+func kmzDocument(files []*zip.File) *zip.File {
+	var root, nested *zip.File
+	for _, f := range files {
+		if strings.ToLower(path.Ext(f.Name)) != ".kml" || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+
+		switch {
+		case strings.EqualFold(f.Name, "doc.kml"):
+			return f
+		case root == nil && !strings.Contains(f.Name, "/"):
+			root = f
+		case nested == nil:
+			nested = f
+		}
+	}
+
+	if root != nil {
+		return root
+	}
+	return nested
+}
+
+// readZipFile reads the whole of a file in a zip
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
@@ -0,0 +1,245 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ControlPoint ... a surveyed point known in both the local mine grid and the grid's SRS
+type ControlPoint struct {
+	LocalX float64 `json:"localx" yaml:"localx"`
+	LocalY float64 `json:"localy" yaml:"localy"`
+	X      float64 `json:"x" yaml:"x"`
+	Y      float64 `json:"y" yaml:"y"`
+}
+
+// MineGrid ... a local mine grid, related to a projected SRS (usually UTM) by a rotation,
+// scale and offset solved from two or more control points.  With Affine, a full 2D affine
+// transform (independent scales and shear) is solved instead, requiring three or more points.
+type MineGrid struct {
+	SRS           int            `json:"srs" yaml:"srs"`
+	Affine        bool           `json:"affine" yaml:"affine"`
+	ControlPoints []ControlPoint `json:"controlpoints" yaml:"controlpoints"`
+
+	// the solution, filled by Solve
+	// x = a*localx + b*localy + c, y = d*localx + e*localy + f
+	Rotation  float64   `json:"rotation" yaml:"rotation"` // degrees, counter clockwise from the srs x axis
+	Scale     float64   `json:"scale" yaml:"scale"`
+	Residuals []float64 `json:"residuals" yaml:"residuals"` // per control point, in srs units
+	RMS       float64   `json:"rms" yaml:"rms"`
+
+	a, b, c, d, e, f float64
+	solved           bool
+}
+
+// NewMineGrid solves a mine grid from its control points, see MineGrid
+func NewMineGrid(srs int, controlPoints []ControlPoint, affine bool) (*MineGrid, error) {
+	grid := MineGrid{SRS: srs, Affine: affine, ControlPoints: controlPoints}
+
+	if err := grid.Solve(); err != nil {
+		return nil, err
+	}
+
+	return &grid, nil
+}
+
+// Solve fits the transform to the control points by least squares, and reports the residuals
+func (g *MineGrid) Solve() error {
+	if _, err := LookupEPSG(g.SRS); err != nil {
+		return fmt.Errorf("mine grid srs: %v", err)
+	}
+
+	n := float64(len(g.ControlPoints))
+	switch {
+	case g.Affine && n < 3:
+		return errors.New("an affine mine grid needs at least three control points")
+	case n < 2:
+		return errors.New("a mine grid needs at least two control points")
+	}
+
+	// work about the centroids, it keeps the normal equations well conditioned
+	var lxm, lym, xm, ym float64
+	for _, cp := range g.ControlPoints {
+		lxm += cp.LocalX / n
+		lym += cp.LocalY / n
+		xm += cp.X / n
+		ym += cp.Y / n
+	}
+
+	var sll, sxx, syy, sxy, sxX, sxY, syX, syY float64
+	for _, cp := range g.ControlPoints {
+		dlx, dly := cp.LocalX-lxm, cp.LocalY-lym
+		dx, dy := cp.X-xm, cp.Y-ym
+
+		sll += dlx*dlx + dly*dly
+		sxx += dlx * dlx
+		syy += dly * dly
+		sxy += dlx * dly
+		sxX += dlx * dx
+		sxY += dlx * dy
+		syX += dly * dx
+		syY += dly * dy
+	}
+
+	if g.Affine {
+		det := sxx*syy - sxy*sxy
+		if math.Abs(det) < 1e-9*sll*sll {
+			return errors.New("mine grid control points are collinear")
+		}
+
+		g.a = (sxX*syy - syX*sxy) / det
+		g.b = (syX*sxx - sxX*sxy) / det
+		g.d = (sxY*syy - syY*sxy) / det
+		g.e = (syY*sxx - sxY*sxy) / det
+	} else {
+		if sll == 0 {
+			return errors.New("mine grid control points are coincident")
+		}
+
+		// similarity, x = a*lx - b*ly, y = b*lx + a*ly
+		a := (sxX + syY) / sll
+		b := (sxY - syX) / sll
+		g.a, g.b, g.d, g.e = a, -b, b, a
+	}
+
+	g.c = xm - g.a*lxm - g.b*lym
+	g.f = ym - g.d*lxm - g.e*lym
+	g.solved = true
+
+	// the x axis of the local grid, as seen from the srs
+	g.Rotation = math.Atan2(g.d, g.a) * rad2deg
+	g.Scale = math.Sqrt(math.Abs(g.a*g.e - g.b*g.d))
+
+	// report the fit
+	g.Residuals = nil
+	var sum float64
+	for _, cp := range g.ControlPoints {
+		x, y := g.Forward(cp.LocalX, cp.LocalY)
+		residual := math.Hypot(x-cp.X, y-cp.Y)
+		g.Residuals = append(g.Residuals, residual)
+		sum += residual * residual
+	}
+	g.RMS = math.Sqrt(sum / n)
+
+	return nil
+}
+
+// Forward converts a local mine grid x y to the grid's srs
+func (g *MineGrid) Forward(localx float64, localy float64) (float64, float64) {
+	return g.a*localx + g.b*localy + g.c, g.d*localx + g.e*localy + g.f
+}
+
+// Inverse converts an x y in the grid's srs to the local mine grid
+func (g *MineGrid) Inverse(x float64, y float64) (float64, float64) {
+	det := g.a*g.e - g.b*g.d
+	x -= g.c
+	y -= g.f
+	return (g.e*x - g.b*y) / det, (g.a*y - g.d*x) / det
+}
+
+// From3857 converts an EPSG:3857 x y, as found in a Datasets, back to the local mine grid
+func (g *MineGrid) From3857(x float64, y float64) (float64, float64, error) {
+	srs, err := LookupEPSG(g.SRS)
+	if err != nil {
+		return x, y, err
+	}
+
+	lon, lat := webMercatorTo4326(x, y)
+	x, y = srs.FromLonLat(lon, lat)
+	localx, localy := g.Inverse(x, y)
+
+	return localx, localy, nil
+}
+
+// DatasetToMineGrid returns a copy of the dataset with every coordinate reported in the mine grid
+// Z is left as is.  The original dataset is not modified.
+func DatasetToMineGrid(dataset *Datasets, grid *MineGrid) (*Datasets, error) {
+	if !grid.solved {
+		if err := grid.Solve(); err != nil {
+			return nil, err
+		}
+	}
+
+	local := *dataset
+
+	// convert a single []float64, never in place
+	convert := func(coord []float64) ([]float64, error) {
+		if len(coord) < 2 {
+			return coord, nil
+		}
+		x, y, err := grid.From3857(coord[0], coord[1])
+		if err != nil {
+			return nil, err
+		}
+		return append([]float64{x, y}, coord[2:]...), nil
+	}
+
+	var err error
+
+	local.Center = nil
+	for _, c := range dataset.Center {
+		c.X, c.Y, err = grid.From3857(c.X, c.Y)
+		if err != nil {
+			return nil, err
+		}
+		local.Center = append(local.Center, c)
+	}
+
+	local.Points = nil
+	for _, point := range dataset.Points {
+		if point.Points, err = convert(point.Points); err != nil {
+			return nil, err
+		}
+		local.Points = append(local.Points, point)
+	}
+
+	local.Lines = nil
+	for _, line := range dataset.Lines {
+		var coords [][]float64
+		for _, coord := range line.Points {
+			converted, err := convert(coord)
+			if err != nil {
+				return nil, err
+			}
+			coords = append(coords, converted)
+		}
+		line.Points = coords
+		local.Lines = append(local.Lines, line)
+	}
+
+	local.Shapes = nil
+	for _, shape := range dataset.Shapes {
+		var polys [][][][]float64
+		for _, poly := range shape.Points {
+			var rings [][][]float64
+			for _, ring := range poly {
+				var coords [][]float64
+				for _, coord := range ring {
+					converted, err := convert(coord)
+					if err != nil {
+						return nil, err
+					}
+					coords = append(coords, converted)
+				}
+				rings = append(rings, coords)
+			}
+			polys = append(polys, rings)
+		}
+		shape.Points = polys
+
+		var vertices [][]float64
+		for _, coord := range shape.Vertices {
+			converted, err := convert(coord)
+			if err != nil {
+				return nil, err
+			}
+			vertices = append(vertices, converted)
+		}
+		shape.Vertices = vertices
+
+		local.Shapes = append(local.Shapes, shape)
+	}
+
+	return &local, nil
+}
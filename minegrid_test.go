@@ -0,0 +1,119 @@
+package convert
+
+import (
+	"math"
+	"testing"
+)
+
+// a mine grid rotated 12.5 degrees off UTM 12N, slightly scaled, with a false origin
+func testMineGrid(local [][2]float64) []ControlPoint {
+	theta := 12.5 * deg2rad
+	scale := 1.0003
+
+	var controlPoints []ControlPoint
+	for _, l := range local {
+		x := scale*(l[0]*math.Cos(theta)-l[1]*math.Sin(theta)) + 390000
+		y := scale*(l[0]*math.Sin(theta)+l[1]*math.Cos(theta)) + 3765000
+		controlPoints = append(controlPoints, ControlPoint{LocalX: l[0], LocalY: l[1], X: x, Y: y})
+	}
+	return controlPoints
+}
+
+func TestMineGridSimilarity(t *testing.T) {
+
+	grid, err := NewMineGrid(32612, testMineGrid([][2]float64{{1000, 5000}, {3000, 6500}}), false)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	if math.Abs(grid.Rotation-12.5) > 1e-9 || math.Abs(grid.Scale-1.0003) > 1e-9 {
+		t.Errorf("mine grid solved to rotation %v scale %v\n", grid.Rotation, grid.Scale)
+	}
+
+	if grid.RMS > 1e-6 {
+		t.Errorf("two exact control points should not leave residuals: %v\n", grid.Residuals)
+	}
+
+	// forward and back
+	x, y := grid.Forward(2000, 5500)
+	localx, localy := grid.Inverse(x, y)
+	if math.Abs(localx-2000) > 1e-6 || math.Abs(localy-5500) > 1e-6 {
+		t.Errorf("mine grid round trip drifted: %v, %v\n", localx, localy)
+	}
+
+	// a mine grid coordinate lands where its utm coordinate does
+	local := Options{MineGrid: grid}
+	got, err := local.checkCoords([]float64{2000, 5500, 640})
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	utm := Options{SRS: 32612}
+	want, _ := utm.checkCoords([]float64{x, y, 640})
+	if got[0] != want[0] || got[1] != want[1] || got[2] != 640 {
+		t.Errorf("mine grid coordinate landed at %v, expected %v\n", got, want)
+	}
+
+	// and can be reported back in the mine grid
+	localx, localy, err = grid.From3857(got[0], got[1])
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if math.Abs(localx-2000) > 0.05 || math.Abs(localy-5500) > 0.05 {
+		t.Errorf("3857 to mine grid drifted: %v, %v\n", localx, localy)
+	}
+}
+
+func TestMineGridAffine(t *testing.T) {
+
+	controlPoints := testMineGrid([][2]float64{{1000, 5000}, {3000, 6500}, {1500, 8000}, {4000, 4000}})
+
+	// survey error on one control point
+	controlPoints[3].X += 0.2
+
+	grid, err := NewMineGrid(32612, controlPoints, true)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	if grid.RMS == 0 || grid.RMS > 0.2 {
+		t.Errorf("affine residuals should report the survey error: %v\n", grid.Residuals)
+	}
+
+	// collinear points can't define an affine transform
+	if _, err := NewMineGrid(32612, testMineGrid([][2]float64{{0, 0}, {1, 1}, {2, 2}}), true); err == nil {
+		t.Errorf("collinear control points should be refused\n")
+	}
+
+	// nor can too few points
+	if _, err := NewMineGrid(32612, testMineGrid([][2]float64{{0, 0}}), false); err == nil {
+		t.Errorf("a single control point should be refused\n")
+	}
+}
+
+func TestDatasetToMineGrid(t *testing.T) {
+
+	grid, _ := NewMineGrid(32612, testMineGrid([][2]float64{{1000, 5000}, {3000, 6500}}), false)
+	local := Options{MineGrid: grid}
+
+	point, _ := local.checkCoords([]float64{2000, 5500, 640})
+	dataset := Datasets{Points: []Points{{Points: point}}}
+
+	reported, err := DatasetToMineGrid(&dataset, grid)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+
+	got := reported.Points[0].Points
+	if math.Abs(got[0]-2000) > 0.05 || math.Abs(got[1]-5500) > 0.05 || got[2] != 640 {
+		t.Errorf("dataset reported in mine grid at %v\n", got)
+	}
+
+	// the original is untouched
+	if dataset.Points[0].Points[0] != point[0] {
+		t.Errorf("DatasetToMineGrid modified the original dataset\n")
+	}
+}
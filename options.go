@@ -0,0 +1,298 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	geo "github.com/paulmach/go.geo"
+)
+
+// Options holds the per-dataset settings accepted by every DatasetFrom* function.
+// Calling a DatasetFrom* function without Options is the same as passing empty Options,
+// so the srs must be declared by SRS, by the source itself, or guessed by opting in to GuessSRS.
+type Options struct {
+	// SRS is the EPSG code of the inbound coordinates, eg 4326, 3857, or 32611
+	// see epsg.go for the supported codes
+	SRS int `json:"srs" yaml:"srs"`
+
+	// GuessSRS opts in to guessing degrees vs meters from coordinate magnitude
+	// when SRS is not declared.  Small UTM or local grid values will be mangled!
+	GuessSRS bool `json:"guesssrs" yaml:"guesssrs"`
+
+	// MineGrid declares the inbound coordinates as a local mine grid, related
+	// to its own SRS by control points.  SRS may be left empty when set.
+	MineGrid *MineGrid `json:"minegrid" yaml:"minegrid"`
+
+	// Elevation supplies Z where the inbound coordinates have none, and the polygon
+	// drapes.  The world DEM (earthdem.vrt, see DemVrtPath) is used when nil.
+	Elevation ElevationProvider `json:"-" yaml:"-"`
+
+	// LocalDEM is a GeoTIFF or Esri ASCII grid, eg a drone LiDAR survey, used for Z and
+	// drapes within its footprint, falling back to Elevation (or the world DEM) outside it.
+	// LocalDEMSRS declares the EPSG code of an ascii grid, a GeoTIFF carries its own.  The reader
+	// is read once, by the first DatasetFrom* call, so Options reused for several conversions need
+	// ReadDEM's *Grid as Elevation instead, eg NewFallbackProvider(grid, vrt) to keep the world DEM.
+	LocalDEM    io.Reader `json:"-" yaml:"-"`
+	LocalDEMSRS int       `json:"localdemsrs" yaml:"localdemsrs"`
+
+	// Interpolation reads the DEM between cell centers, nearest (the default), bilinear or
+	// bicubic, for Z filling, the center point, and polygon drapes alike
+	Interpolation Interpolation `json:"interpolation" yaml:"interpolation"`
+
+	// Drape densifies lines and rings without Z, inserting a vertex every DrapeSpacing
+	// meters (0 for the DEM cell size) so they follow the terrain between their vertices
+	Drape        bool    `json:"drape" yaml:"drape"`
+	DrapeSpacing float64 `json:"drapespacing" yaml:"drapespacing"`
+
+	// AltitudeMode reads Z as an elevation (absolute, the default), a height above the DEM
+	// (relativeToGround), or not at all (clampToGround), for points, lines and outlines alike.
+	// ZOffset is then added to every Z, eg to lift features off the terrain.
+	AltitudeMode AltitudeMode `json:"altitudemode" yaml:"altitudemode"`
+	ZOffset      float64      `json:"zoffset" yaml:"zoffset"`
+
+	// ZDatum declares the inbound Z as orthometric (the default, as the world DEM) or ellipsoidal
+	// (eg phone GPX), and OutputZDatum the Z of the dataset.  Converting between them needs a
+	// geoid model, eg EGM96 or EGM2008, read from GeoidPath (see ReadGeoid) unless Geoid is set.
+	ZDatum       HeightDatum `json:"zdatum" yaml:"zdatum"`
+	OutputZDatum HeightDatum `json:"outputzdatum" yaml:"outputzdatum"`
+	GeoidPath    string      `json:"geoidpath" yaml:"geoidpath"`
+	Geoid        *Geoid      `json:"-" yaml:"-"`
+
+	// HorizontalUnits and VerticalUnits declare the units of the inbound x y and z, meters (the
+	// default), international feet (ft) or US survey feet (us-ft), independently.  Horizontal
+	// units need a projected SRS, and are converted to its units.  Z is converted to meters.
+	HorizontalUnits Unit `json:"horizontalunits" yaml:"horizontalunits"`
+	VerticalUnits   Unit `json:"verticalunits" yaml:"verticalunits"`
+
+	// GeometryField names a DatasetFromCSV column of WKT or hex (E)WKB geometry, see
+	// DecodeGeometry, so rows become Lines and Shapes as well as Points.  The x y z fields
+	// are then ignored.  An SRID in the geometry declares the SRS, unless Options.SRS does.
+	GeometryField string `json:"geometryfield" yaml:"geometryfield"`
+
+	// srs is the resolved crs of SRS
+	srs *CRS
+}
+
+// guessOptions are used where no Options can be given, eg CheckCoords or a Parse* function
+// without a container, and guess the srs from coordinate magnitude as those always have
+var guessOptions = Options{GuessSRS: true}
+
+// resolveOptions picks the Options of a DatasetFrom* call and validates them
+func resolveOptions(opts []Options) (*Options, error) {
+	var o Options
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if err := o.Interpolation.valid(); err != nil {
+		return nil, err
+	}
+
+	if err := o.AltitudeMode.valid(); err != nil {
+		return nil, err
+	}
+
+	for _, datum := range []HeightDatum{o.ZDatum, o.OutputZDatum} {
+		if err := datum.valid(); err != nil {
+			return nil, err
+		}
+	}
+
+	// an ellipsoidal height needs the geoid
+	if o.needsGeoid() && o.Geoid == nil {
+		if o.GeoidPath == "" {
+			return nil, errors.New("an ellipsoidal height datum needs a geoid model, set Options.GeoidPath or Options.Geoid")
+		}
+
+		geoid, err := LoadGeoid(o.GeoidPath)
+		if err != nil {
+			return nil, err
+		}
+		o.Geoid = geoid
+	}
+
+	if o.DrapeSpacing < 0 {
+		return nil, fmt.Errorf("drape spacing %v must be positive", o.DrapeSpacing)
+	}
+
+	// a local dem goes ahead of the declared provider, or the world dem if there is one
+	if o.LocalDEM != nil {
+		grid, err := ReadDEM(o.LocalDEM, o.LocalDEMSRS)
+		if err != nil {
+			return nil, fmt.Errorf("local dem: %v", err)
+		}
+
+		fallback := o.Elevation
+		if fallback == nil {
+			fallback, err = defaultElevation()
+			if err != nil {
+				fmt.Printf("Warning: [resolveOptions] in pkg [convert] found no world DEM, the local DEM is used alone: %v\n", err)
+			}
+		}
+
+		o.Elevation = grid
+		if fallback != nil {
+			o.Elevation = NewFallbackProvider(grid, fallback)
+		}
+		o.LocalDEM = nil
+	}
+
+	// without a provider, the world dem is required
+	if o.Elevation == nil {
+		if _, err := DemVrtPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	// a mine grid carries its own srs
+	if o.MineGrid != nil {
+		if o.SRS != 0 && o.SRS != o.MineGrid.SRS {
+			return nil, fmt.Errorf("declared srs EPSG:%d conflicts with the mine grid srs EPSG:%d", o.SRS, o.MineGrid.SRS)
+		}
+
+		// solved on a copy, resolving leaves the caller's grid as it was
+		grid := *o.MineGrid
+		if err := grid.Solve(); err != nil {
+			return nil, err
+		}
+		o.MineGrid = &grid
+
+		o.SRS = o.MineGrid.SRS
+	}
+
+	if o.SRS == 0 && !o.GuessSRS {
+		return nil, errors.New("no source srs declared, set Options.SRS or opt in to Options.GuessSRS")
+	}
+
+	if o.SRS != 0 {
+		srs, err := LookupEPSG(o.SRS)
+		if err != nil {
+			return nil, err
+		}
+		o.srs = srs
+	}
+
+	if err := o.validUnits(); err != nil {
+		return nil, err
+	}
+
+	return &o, nil
+}
+
+// options returns the Options the container was started with, or the guess without one
+func (container *ExtentContainer) options() *Options {
+	if container == nil || container.opts == nil {
+		return &guessOptions
+	}
+	return container.opts
+}
+
+// crs returns the declared crs, or nil if the srs is to be guessed
+func (o *Options) crs() (*CRS, error) {
+	switch {
+	case o.srs != nil:
+		return o.srs, nil
+	case o.SRS != 0:
+		return LookupEPSG(o.SRS)
+	case o.MineGrid != nil:
+		return LookupEPSG(o.MineGrid.SRS)
+	}
+	return nil, nil
+}
+
+// declareLonLat declares EPSG:4326 for the formats that are lon lat by spec, eg kml and gpx, as
+// declareCRS does a .prj.  GuessSRS keeps the magnitude guess.
+func declareLonLat(source string, opts []Options) ([]Options, error) {
+	if len(opts) > 0 && opts[0].GuessSRS {
+		return opts, nil
+	}
+
+	crs, err := LookupEPSG(4326)
+	if err != nil {
+		return nil, err
+	}
+	return declareCRS(crs, source, opts)
+}
+
+// fromMineGrid takes a local mine grid x y to the grid's srs, if a mine grid is declared
+func (o *Options) fromMineGrid(x float64, y float64) (float64, float64) {
+	if o.MineGrid == nil {
+		return x, y
+	}
+	return o.MineGrid.Forward(x, y)
+}
+
+// to3857 converts an x y in the declared srs to EPSG:3857
+func (o *Options) to3857(x float64, y float64) (float64, float64, error) {
+	srs, err := o.crs()
+	if err != nil {
+		return x, y, err
+	}
+
+	x, y = o.fromUnits(x, y)
+	x, y = o.fromMineGrid(x, y)
+
+	switch {
+	case srs == nil:
+		// legacy magnitude check, only reached if GuessSRS
+		px, py := To3857(x, y)
+		if math.IsNaN(px) || math.IsNaN(py) || math.IsInf(py, 0) {
+			return x, y, fmt.Errorf("coordinate %v, %v cannot be projected to EPSG:3857", x, y)
+		}
+		return px, py, nil
+	case srs.IsWebMercator():
+		return roundCm(x), roundCm(y), nil
+	}
+
+	lon, lat, err := srsToLonLat(srs, x, y)
+	if err != nil {
+		return x, y, err
+	}
+
+	x, y = lonLatTo3857(lon, lat)
+	return x, y, nil
+}
+
+// to4326 converts an x y in the declared srs to EPSG:4326 lon lat
+func (o *Options) to4326(x float64, y float64) (float64, float64, error) {
+	srs, err := o.crs()
+	if err != nil {
+		return x, y, err
+	}
+
+	x, y = o.fromUnits(x, y)
+	x, y = o.fromMineGrid(x, y)
+
+	if srs == nil {
+		x, y = To4326(x, y)
+		return x, y, nil
+	}
+
+	return srsToLonLat(srs, x, y)
+}
+
+// srsToLonLat converts an x y of the crs to lon lat, refusing coordinates the crs can't hold
+func srsToLonLat(srs *CRS, x float64, y float64) (float64, float64, error) {
+	lon, lat := srs.ToLonLat(x, y)
+	if math.IsNaN(lon) || math.IsNaN(lat) || math.Abs(lat) > 90 {
+		return x, y, fmt.Errorf("coordinate %v, %v is outside of %s", x, y, srs.Name)
+	}
+
+	return lon, lat, nil
+}
+
+// lonLatTo3857 projects a lon lat to EPSG:3857 without guessing, trimmed to the cm
+func lonLatTo3857(lon float64, lat float64) (float64, float64) {
+	mercPoint := geo.NewPoint(lon, lat)
+	geo.Mercator.Project(mercPoint)
+	return roundCm(mercPoint[0]), roundCm(mercPoint[1])
+}
+
+// webMercatorTo4326 unprojects an EPSG:3857 x y to lon lat without guessing
+func webMercatorTo4326(x float64, y float64) (float64, float64) {
+	mercPoint := geo.NewPoint(x, y)
+	geo.Mercator.Inverse(mercPoint)
+	return mercPoint[0], mercPoint[1]
+}
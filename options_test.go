@@ -0,0 +1,123 @@
+package convert
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDeclaredSRS(t *testing.T) {
+
+	// small web mercator values near 0,0 must not be projected a second time
+	mercator := Options{SRS: 3857}
+	coord, err := mercator.checkCoords([]float64{120.5, -45.25, 10})
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if coord[0] != 120.5 || coord[1] != -45.25 || coord[2] != 10 {
+		t.Errorf("declared EPSG:3857 coord was modified: %v\n", coord)
+	}
+
+	// the same values declared as lon lat must be projected
+	lonlat := Options{SRS: 4326}
+	coord, err = lonlat.checkCoords([]float64{120.5, -45.25, 10})
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if coord[0] != 13413998.64 || coord[1] != -5660965.11 {
+		t.Errorf("declared EPSG:4326 coord was not projected correctly: %v\n", coord)
+	}
+
+	// the legacy guess still projects anything within +-180
+	coord, err = CheckCoords([]float64{120.5, -45.25, 10})
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if coord[0] != 13413998.64 {
+		t.Errorf("guessed coord was not projected: %v\n", coord)
+	}
+}
+
+func TestResolveOptions(t *testing.T) {
+
+	// no options at all is no guess, the srs must be declared
+	if _, err := resolveOptions(nil); err == nil {
+		t.Errorf("missing options should not fall back to guessing the srs\n")
+	}
+
+	// a utm csv is refused rather than mangled
+	utm := "x,y\n392600,3769700\n"
+	if _, err := DatasetFromCSV("x", "y", "", strings.NewReader(utm)); err == nil {
+		t.Errorf("a csv without options or an srs should be refused\n")
+	}
+
+	// options without an srs must opt in to guessing
+	if _, err := resolveOptions([]Options{{}}); err == nil {
+		t.Errorf("options without an srs or GuessSRS should be refused\n")
+	}
+
+	// unknown codes fail loudly
+	if _, err := resolveOptions([]Options{{SRS: 1}}); err == nil {
+		t.Errorf("EPSG:1 should be refused\n")
+	}
+}
+
+func TestUnits(t *testing.T) {
+
+	// utm 12N in international feet, with elevations in us survey feet
+	item := "tests/units/samples_ft.csv"
+	data, err := os.Open(item)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer data.Close()
+
+	opts := Options{SRS: 32612, HorizontalUnits: Feet, VerticalUnits: USSurveyFeet, Elevation: ConstantProvider{}}
+	results, err := DatasetFromCSV("easting_ft", "northing_ft", "elev_usft", data, opts)
+	if err != nil {
+		t.Errorf("csv conversion error for %s: %v\n", item, err)
+		return
+	}
+
+	// the same samples in meters
+	meters := Options{SRS: 32612}
+	expected := [][]float64{{392500, 3770000, 1000}, {393000, 3770300, 1100}, {392750, 3769800, 1050}}
+	if len(results.Points) != len(expected) {
+		t.Errorf("%s had %d points, expected %d\n", item, len(results.Points), len(expected))
+		return
+	}
+	for i, point := range results.Points {
+		coord, _ := meters.checkCoords(expected[i])
+		if math.Abs(point.Points[0]-coord[0]) > 0.02 || math.Abs(point.Points[1]-coord[1]) > 0.02 || math.Abs(point.Points[2]-coord[2]) > 0.001 {
+			t.Errorf("sample %d in feet converted to %v, expected %v\n", i, point.Points, coord)
+		}
+	}
+
+	metadata := map[string]string{}
+	for _, att := range results.Metadata {
+		metadata[att.Key] = att.Value
+	}
+	if metadata["horizontalunits"] != "ft" || metadata["verticalunits"] != "us-ft" {
+		t.Errorf("the original units were not recorded in the metadata: %v\n", results.Metadata)
+	}
+
+	// a state plane srs in us survey feet needs no conversion
+	statePlane, _ := resolveOptions([]Options{{SRS: 2229, Elevation: ConstantProvider{}}})
+	declared, _ := resolveOptions([]Options{{SRS: 2229, HorizontalUnits: USSurveyFeet, Elevation: ConstantProvider{}}})
+	a, _ := statePlane.checkCoords([]float64{6500000, 1900000, 10})
+	b, _ := declared.checkCoords([]float64{6500000, 1900000, 10})
+	if a[0] != b[0] || a[1] != b[1] {
+		t.Errorf("us survey feet on a us survey feet srs moved %v to %v\n", a, b)
+	}
+
+	// degrees have no feet
+	if _, err := resolveOptions([]Options{{SRS: 4326, HorizontalUnits: Feet, Elevation: ConstantProvider{}}}); err == nil {
+		t.Errorf("horizontal units on EPSG:4326 should be refused\n")
+	}
+
+	if _, err := resolveOptions([]Options{{SRS: 32612, VerticalUnits: "fathoms", Elevation: ConstantProvider{}}}); err == nil {
+		t.Errorf("an unknown unit should be refused\n")
+	}
+}
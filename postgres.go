@@ -0,0 +1,271 @@
+package convert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// postgresGeometryFields are the usual names of a postgis geometry column, tried in order
+// when the geometry field isn't named
+var postgresGeometryFields = []string{"geom", "geometry", "the_geom", "wkb_geometry", "geog", "st_asgeojson"}
+
+// postgresRow ... a row of a query as json, its columns in order
+type postgresRow struct {
+	columns []string
+	values  map[string]json.RawMessage
+}
+
+// DatasetFromPostgresJSON converts the rows of a postgis query as json, an array of rows as
+// json_agg returns them, or rows one after another as row_to_json does, eg
+//
+//	SELECT json_agg(t) FROM (SELECT id, name, geom FROM claims) t
+//
+// geomField names the geometry column, a usual name (geom, the_geom ...) if empty, as hex EWKB
+// (postgis' default), geojson (ST_AsGeoJSON) or EWKT.  The other columns are attributes, in order.
+// The geometries' SRID declares the srs, unless Options.SRS or a mine grid does.  SRID 0
+// needs Options.SRS, or Options.GuessSRS to guess the srs from coordinate magnitude.
+func DatasetFromPostgresJSON(geomField string, contents io.Reader, opts ...Options) (*Datasets, error) {
+	rows, err := readPostgresRows(contents)
+	if err != nil {
+		return nil, fmt.Errorf("[DatasetFromPostgresJSON] in pkg [convert] encountered: %v", err)
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("no data in dataset")
+	}
+
+	if geomField == "" {
+		for _, field := range postgresGeometryFields {
+			if _, ok := rows[0].values[field]; ok {
+				geomField = field
+				break
+			}
+		}
+		if geomField == "" {
+			return nil, fmt.Errorf("no geometry column among %s, name one", strings.Join(rows[0].columns, ", "))
+		}
+	}
+
+	// decode every geometry up front, the first srid says where the coordinates are
+	geometries := make([]*geojson.Geometry, len(rows))
+	srids := make([]int, len(rows))
+	errs := make([]error, len(rows))
+	for i, row := range rows {
+		geometries[i], srids[i], errs[i] = decodePostgresGeometry(row.values[geomField])
+	}
+
+	for _, srid := range srids {
+		if srid == 0 {
+			continue
+		}
+
+		crs, err := LookupEPSG(srid)
+		if err != nil {
+			return nil, err
+		}
+		if opts, err = declareCRS(crs, "postgis srid", opts); err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	// ensure demvrt is set, unless an elevation provider is declared
+	options, err := resolveOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var outdataset Datasets
+	container := initExtentContainer(options)
+
+	for i, row := range rows {
+		if errs[i] != nil {
+			fmt.Printf("NonFatal [decodePostgresGeometry] row %d encountered %v\n", i+1, errs[i].Error())
+			continue
+		}
+
+		// a null or empty geometry is no feature
+		if geometries[i] == nil {
+			continue
+		}
+
+		if err := checkSRID(srids[i], container); err != nil {
+			fmt.Printf("NonFatal [checkSRID] row %d encountered %v\n", i+1, err.Error())
+			continue
+		}
+
+		properties, headers := row.properties(geomField)
+		if err := parseFeatureGeometries(splitGeometry(geometries[i]), properties, headers, &outdataset, container); err != nil {
+			fmt.Printf("NonFatal [parseFeatureGeometries] row %d encountered %v\n", i+1, err.Error())
+		}
+	}
+
+	// close the BBOXlistener goroutine
+	close(container.ch)
+
+	// make sure there's valid features in the dataset
+	if len(outdataset.Points) == 0 && len(outdataset.Lines) == 0 && len(outdataset.Shapes) == 0 {
+		return nil, errors.New("no valid features in dataset")
+	}
+
+	// configure the center point... in 4326
+	c, err := getCenter(container)
+	if err != nil {
+		return nil, err
+	}
+	outdataset.Center = append(outdataset.Center, c)
+
+	// configure the s2 array... in 4326
+	outdataset.S2 = s2covering(container)
+
+	// record how the dataset was read
+	outdataset.Metadata = container.options().metadata()
+
+	return &outdataset, nil
+}
+
+// readPostgresRows reads json arrays of rows and bare rows, in any mix, keeping the order of
+// each row's columns.  A null, as json_agg returns for no rows, is skipped.
+func readPostgresRows(contents io.Reader) ([]postgresRow, error) {
+	decoder := json.NewDecoder(contents)
+
+	var rows []postgresRow
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch token {
+		case nil:
+
+		case json.Delim('['):
+			for decoder.More() {
+				if token, err = decoder.Token(); err != nil {
+					return nil, err
+				}
+				if token == nil {
+					continue
+				}
+				if token != json.Delim('{') {
+					return nil, fmt.Errorf("expected a row, found %v", token)
+				}
+
+				row, err := readPostgresRow(decoder)
+				if err != nil {
+					return nil, err
+				}
+				rows = append(rows, row)
+			}
+
+			// the closing bracket
+			if _, err := decoder.Token(); err != nil {
+				return nil, err
+			}
+
+		case json.Delim('{'):
+			row, err := readPostgresRow(decoder)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+
+		default:
+			return nil, fmt.Errorf("expected rows, found %v", token)
+		}
+	}
+}
+
+// readPostgresRow reads the columns of a row, its opening brace already read
+func readPostgresRow(decoder *json.Decoder) (postgresRow, error) {
+	row := postgresRow{values: make(map[string]json.RawMessage)}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return row, err
+		}
+		column, _ := token.(string)
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return row, err
+		}
+
+		if _, ok := row.values[column]; !ok {
+			row.columns = append(row.columns, column)
+		}
+		row.values[column] = value
+	}
+
+	// the closing brace
+	_, err := decoder.Token()
+	return row, err
+}
+
+// properties returns the columns but the geometry as geojson style properties, and their keys
+// in order.  Json objects and arrays are kept as their json.
+func (row postgresRow) properties(geomField string) (map[string]interface{}, []string) {
+	properties := make(map[string]interface{})
+	var headers []string
+
+	for _, column := range row.columns {
+		if column == geomField {
+			continue
+		}
+
+		raw := row.values[column]
+		var value interface{}
+		if trimmed := strings.TrimSpace(string(raw)); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			value = trimmed
+		} else if err := json.Unmarshal(raw, &value); err != nil {
+			continue
+		}
+
+		key := propertyKey(column)
+		properties[key] = value
+		headers = append(headers, key)
+	}
+
+	return properties, headers
+}
+
+// decodePostgresGeometry reads a geometry column, geojson as json or text (ST_AsGeoJSON), or
+// hex EWKB or EWKT as postgis prints them.  A geojson geometry's crs member is its srid.
+func decodePostgresGeometry(raw json.RawMessage) (*geojson.Geometry, int, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" {
+		return nil, 0, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		if !strings.HasPrefix(strings.TrimSpace(text), "{") {
+			return DecodeGeometry(text)
+		}
+		raw = json.RawMessage(text)
+	}
+
+	geometry, err := geojson.UnmarshalGeometry(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(geometry.CRS) == 0 {
+		return geometry, 0, nil
+	}
+
+	crs, err := geojsonCRS(geometry.CRS)
+	if err != nil {
+		return nil, 0, err
+	}
+	return geometry, crs.EPSG, nil
+}
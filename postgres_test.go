@@ -0,0 +1,72 @@
+package convert
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const (
+	//postgres testing dataset, as json_agg returns it
+	claimsjson = "tests/postgres/claims.json"
+)
+
+func TestPostgresJSON(t *testing.T) {
+
+	data, err := os.Open(claimsjson)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer data.Close()
+
+	// no srs declared, the srid of the geometries has it
+	results, err := DatasetFromPostgresJSON("", data, Options{Elevation: ConstantProvider{Z: 1234}})
+	if err != nil {
+		t.Errorf("postgres json conversion error for %s: %v\n", claimsjson, err)
+		return
+	}
+
+	// the null geometry is skipped
+	if len(results.Points) != 1 || len(results.Lines) != 1 || len(results.Shapes) != 1 {
+		t.Errorf("%s had %d points, %d lines and %d shapes, expected 1 of each\n", claimsjson, len(results.Points), len(results.Lines), len(results.Shapes))
+		return
+	}
+
+	utm := Options{SRS: 32612}
+	expected, _ := utm.checkCoords([]float64{392500, 3770000, 1510.5})
+	point := results.Points[0]
+	if point.Name != "S-001" || point.ID != "2" || point.Points[0] != expected[0] || point.Points[1] != expected[1] || point.Points[2] != expected[2] {
+		t.Errorf("ewkb sample %q id %q was %v, expected S-001 id 2 at %v\n", point.Name, point.ID, point.Points, expected)
+	}
+
+	// columns in order, nulls dropped
+	want := []Attribute{{Key: "au_gpt", Value: "1.25"}, {Key: "assayed", Value: "true"}}
+	if len(point.Attributes) != len(want) || point.Attributes[0] != want[0] || point.Attributes[1] != want[1] {
+		t.Errorf("ewkb sample attributes were %v, expected %v\n", point.Attributes, want)
+	}
+
+	// a json column is kept as json
+	claim := results.Shapes[0]
+	if len(claim.Attributes) != 2 || claim.Attributes[1].Key != "survey" || claim.Attributes[1].Value != `{"year": 2021, "crew": "north"}` {
+		t.Errorf("claim attributes were %v\n", claim.Attributes)
+	}
+
+	// a geojson geometry without z is filled from the dem
+	if road := results.Lines[0]; road.Name != "Haul road" || road.Points[0][2] != 1234 {
+		t.Errorf("road %q was %v, expected the dem's 1234\n", road.Name, road.Points[0])
+	}
+
+	// row_to_json rows one per line, with ewkt, must agree with the declared srs
+	rows := `{"fid": 7, "shape": "SRID=4326;POINT(-114.5 34.1)", "note": "ok"}
+{"fid": 8, "shape": "SRID=4326;POINT(-114.6 34.2)", "note": "ok"}`
+
+	results, err = DatasetFromPostgresJSON("shape", strings.NewReader(rows), Options{SRS: 4326, Elevation: ConstantProvider{}})
+	if err != nil || len(results.Points) != 2 || results.Points[1].ID != "8" {
+		t.Errorf("row_to_json rows were %v, %v expected two points\n", results, err)
+	}
+
+	if _, err := DatasetFromPostgresJSON("shape", strings.NewReader(rows), Options{SRS: 32612, Elevation: ConstantProvider{}}); err == nil {
+		t.Errorf("a srid conflicting with the declared srs should be refused\n")
+	}
+}
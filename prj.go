@@ -0,0 +1,211 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// esriNames are the esri names of registered crs that the normalized names can't match
+var esriNames = map[string]int{
+	"gcs_wgs_1984":                                            4326,
+	"gcs_north_american_1983":                                 4269,
+	"gcs_north_american_1983_csrs":                            4617,
+	"gcs_north_american_1927":                                 4267,
+	"gcs_gda_1994":                                            4283,
+	"gcs_gda2020":                                             7844,
+	"gcs_etrs_1989":                                           4258,
+	"gcs_european_1950":                                       4230,
+	"wgs_1984_web_mercator_auxiliary_sphere":                  3857,
+	"wgs_1984_web_mercator":                                   3857,
+	"nad_1983_stateplane_california_iii_fips_0403":            26943,
+	"nad_1983_stateplane_california_iii_fips_0403_feet":       2227,
+	"nad_1983_stateplane_california_v_fips_0405":              26945,
+	"nad_1983_stateplane_california_v_fips_0405_feet":         2229,
+	"nad_1983_stateplane_colorado_central_fips_0502":          26954,
+	"nad_1983_stateplane_colorado_central_fips_0502_feet":     2232,
+	"nad_1983_stateplane_new_york_long_island_fips_3104_feet": 2263,
+	"nad_1983_stateplane_new_jersey_fips_2900":                32111,
+	"nad_1983_stateplane_arizona_central_fips_0202":           26949,
+	"nad_1983_stateplane_arizona_central_fips_0202_feet_intl": 2223,
+	"nad_1983_stateplane_nevada_east_fips_2701":               32107,
+	"nad_1983_stateplane_nevada_central_fips_2702":            32108,
+	"nad_1983_stateplane_nevada_west_fips_2703":               32109,
+	"nad_1983_albers":                                         5070,
+	"british_national_grid":                                   27700,
+	"nzgd_2000_new_zealand_transverse_mercator":               2193,
+}
+
+// registryNames indexes the registry by normalized name, built once
+var registryNames map[string]int
+var registryNamesOnce sync.Once
+
+// normalizeCRSName reduces a crs name to lowercase letters and digits, with the esri spellings
+// of the common datums shortened, so "WGS_1984_UTM_Zone_12N" matches "WGS 84 / UTM zone 12N"
+func normalizeCRSName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+
+	normalized := b.String()
+	for _, datum := range [][2]string{{"wgs1984", "wgs84"}, {"nad1983", "nad83"}, {"nad1927", "nad27"}, {"gda1994", "gda94"}, {"etrs1989", "etrs89"}, {"european1950", "ed50"}} {
+		normalized = strings.Replace(normalized, datum[0], datum[1], 1)
+	}
+	return normalized
+}
+
+// wktNode ... a KEYWORD["name", ...] of well known text
+type wktNode struct {
+	keyword string
+	args    []interface{} // string, or *wktNode
+}
+
+// parseWKT parses well known text into its tree of nodes
+func parseWKT(wkt string) (*wktNode, error) {
+	node, rest, err := parseWKTNode(strings.TrimSpace(wkt))
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("unexpected %q after the wkt", rest)
+	}
+	return node, nil
+}
+
+// parseWKTNode parses one node, returning what follows it
+func parseWKTNode(s string) (*wktNode, string, error) {
+	open := strings.IndexAny(s, "[(")
+	if open < 1 {
+		return nil, s, errors.New("wkt keyword expected")
+	}
+
+	node := &wktNode{keyword: strings.ToUpper(strings.TrimSpace(s[:open]))}
+	s = s[open+1:]
+
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return nil, s, fmt.Errorf("unterminated wkt %s", node.keyword)
+		}
+
+		switch {
+		case s[0] == ']' || s[0] == ')':
+			return node, s[1:], nil
+
+		case s[0] == ',':
+			s = s[1:]
+
+		case s[0] == '"':
+			// quoted, a doubled quote is a literal quote
+			var b strings.Builder
+			i := 1
+			for ; i < len(s); i++ {
+				if s[i] == '"' {
+					if i+1 < len(s) && s[i+1] == '"' {
+						b.WriteByte('"')
+						i++
+						continue
+					}
+					break
+				}
+				b.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, s, errors.New("unterminated wkt string")
+			}
+			node.args = append(node.args, b.String())
+			s = s[i+1:]
+
+		default:
+			end := strings.IndexAny(s, ",[]()")
+			if end < 0 {
+				return nil, s, fmt.Errorf("unterminated wkt %s", node.keyword)
+			}
+
+			// a nested node, or a bare number or enum
+			if s[end] == '[' || s[end] == '(' {
+				child, rest, err := parseWKTNode(s)
+				if err != nil {
+					return nil, s, err
+				}
+				node.args = append(node.args, child)
+				s = rest
+				continue
+			}
+
+			node.args = append(node.args, strings.TrimSpace(s[:end]))
+			s = s[end:]
+		}
+	}
+}
+
+// name is the first argument of a node, eg the name of a PROJCS
+func (node *wktNode) name() string {
+	if len(node.args) > 0 {
+		if name, ok := node.args[0].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// epsg is the EPSG code of the node's own AUTHORITY (wkt1) or ID (wkt2), 0 if it has none
+func (node *wktNode) epsg() int {
+	for _, arg := range node.args {
+		child, ok := arg.(*wktNode)
+		if !ok || (child.keyword != "AUTHORITY" && child.keyword != "ID") || len(child.args) < 2 {
+			continue
+		}
+
+		authority, _ := child.args[0].(string)
+		code, _ := child.args[1].(string)
+		if !strings.EqualFold(authority, "EPSG") {
+			continue
+		}
+
+		if n, err := strconv.Atoi(code); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// LookupPRJ returns the crs of a .prj, the well known text of a shapefile's crs.  The EPSG
+// authority is used if the wkt has one, otherwise the crs is matched by its (esri) name.
+func LookupPRJ(wkt string) (*CRS, error) {
+	node, err := parseWKT(wkt)
+	if err != nil {
+		return nil, fmt.Errorf("unreadable prj: %v", err)
+	}
+
+	if code := node.epsg(); code != 0 {
+		return LookupEPSG(code)
+	}
+
+	name := node.name()
+	if code, ok := esriNames[strings.ToLower(name)]; ok {
+		return LookupEPSG(code)
+	}
+
+	registryNamesOnce.Do(func() {
+		registryNames = make(map[string]int)
+		for code, crs := range registry {
+			// the aliases of web mercator share its crs
+			if crs.EPSG == code {
+				registryNames[normalizeCRSName(crs.Name)] = code
+			}
+		}
+	})
+
+	if code, ok := registryNames[normalizeCRSName(name)]; ok {
+		return LookupEPSG(code)
+	}
+
+	return nil, fmt.Errorf("unsupported prj crs %s", name)
+}
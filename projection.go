@@ -0,0 +1,480 @@
+package convert
+
+import (
+	"math"
+)
+
+// The types and fxtns below are a small, pure go projection engine
+// They take projected or geographic coordinates of a given CRS to
+// WGS84 lon lat (and back), after which To3857 / lonLatTo3857 can finish the job.
+// Only the horizontal position is ever transformed, Z is passed through untouched.
+
+const (
+	deg2rad = math.Pi / 180
+	rad2deg = 180 / math.Pi
+
+	// arc seconds to radians, used by the helmert rotations
+	sec2rad = deg2rad / 3600
+
+	// us survey foot, in meters
+	usFoot = 1200.0 / 3937.0
+
+	// international foot, in meters
+	intFoot = 0.3048
+)
+
+// Ellipsoid ... the reference ellipsoid of a datum
+type Ellipsoid struct {
+	Name string
+	A    float64 // semi-major axis in meters
+	InvF float64 // inverse flattening
+}
+
+// es is the first eccentricity squared
+func (e Ellipsoid) es() float64 {
+	f := 1 / e.InvF
+	return 2*f - f*f
+}
+
+// Datum ... an ellipsoid and its helmert shift to WGS84
+type Datum struct {
+	Name      string
+	Ellipsoid Ellipsoid
+
+	// ToWGS84 holds the 7 helmert parameters, position vector convention (as PROJ +towgs84)
+	// dx dy dz in meters, rx ry rz in arc seconds, ds in ppm
+	ToWGS84 [7]float64
+}
+
+// isWGS84 is true when the datum needs no shift to WGS84
+func (d Datum) isWGS84() bool {
+	return d.ToWGS84 == [7]float64{}
+}
+
+// Projection ... maps lon lat (degrees, on the datum of its CRS) to meters and back
+type Projection interface {
+	Forward(lon float64, lat float64) (float64, float64)
+	Inverse(x float64, y float64) (float64, float64)
+}
+
+// CRS ... a coordinate reference system, as found in the EPSG registry
+type CRS struct {
+	EPSG       int
+	Name       string
+	Datum      Datum
+	Projection Projection // nil for geographic crs
+	ToMeter    float64    // linear unit of projected coordinates, 1 for meters
+}
+
+// IsGeographic is true when the crs holds lon lat degrees
+func (c *CRS) IsGeographic() bool {
+	return c.Projection == nil
+}
+
+// IsWebMercator is true when the crs is already EPSG:3857
+func (c *CRS) IsWebMercator() bool {
+	_, ok := c.Projection.(webMercator)
+	return ok
+}
+
+// ToLonLat converts an x y of this crs to WGS84 lon lat
+func (c *CRS) ToLonLat(x float64, y float64) (float64, float64) {
+	lon, lat := x, y
+
+	if c.Projection != nil {
+		lon, lat = c.Projection.Inverse(x*c.toMeter(), y*c.toMeter())
+	}
+
+	if !c.Datum.isWGS84() {
+		lon, lat = helmert(c.Datum.Ellipsoid, wgs84, c.Datum.ToWGS84, lon, lat, false)
+	}
+
+	return lon, lat
+}
+
+// FromLonLat converts a WGS84 lon lat to an x y of this crs
+func (c *CRS) FromLonLat(lon float64, lat float64) (float64, float64) {
+	if !c.Datum.isWGS84() {
+		lon, lat = helmert(wgs84, c.Datum.Ellipsoid, c.Datum.ToWGS84, lon, lat, true)
+	}
+
+	if c.Projection == nil {
+		return lon, lat
+	}
+
+	x, y := c.Projection.Forward(lon, lat)
+	return x / c.toMeter(), y / c.toMeter()
+}
+
+// toMeter defaults the unit of a crs to meters
+func (c *CRS) toMeter() float64 {
+	if c.ToMeter == 0 {
+		return 1
+	}
+	return c.ToMeter
+}
+
+// helmert shifts a lon lat between datums via geocentric coordinates
+// inverse applies the parameters in the WGS84 -> datum direction
+func helmert(from Ellipsoid, to Ellipsoid, p [7]float64, lon float64, lat float64, inverse bool) (float64, float64) {
+	X, Y, Z := geodeticToGeocentric(from, lon, lat, 0)
+
+	dx, dy, dz := p[0], p[1], p[2]
+	rx, ry, rz := p[3]*sec2rad, p[4]*sec2rad, p[5]*sec2rad
+	s := 1 + p[6]*1e-6
+
+	if inverse {
+		// small angles, so negating the parameters is the inverse to well under a mm
+		dx, dy, dz, rx, ry, rz = -dx, -dy, -dz, -rx, -ry, -rz
+		s = 1 / s
+	}
+
+	// position vector rotation
+	X2 := dx + s*(X-rz*Y+ry*Z)
+	Y2 := dy + s*(rz*X+Y-rx*Z)
+	Z2 := dz + s*(-ry*X+rx*Y+Z)
+
+	lon, lat, _ = geocentricToGeodetic(to, X2, Y2, Z2)
+	return lon, lat
+}
+
+// geodeticToGeocentric converts lon lat h to earth centered X Y Z
+func geodeticToGeocentric(e Ellipsoid, lon float64, lat float64, h float64) (float64, float64, float64) {
+	es := e.es()
+	lam := lon * deg2rad
+	phi := lat * deg2rad
+
+	N := e.A / math.Sqrt(1-es*math.Sin(phi)*math.Sin(phi))
+
+	X := (N + h) * math.Cos(phi) * math.Cos(lam)
+	Y := (N + h) * math.Cos(phi) * math.Sin(lam)
+	Z := (N*(1-es) + h) * math.Sin(phi)
+
+	return X, Y, Z
+}
+
+// geocentricToGeodetic converts earth centered X Y Z to lon lat h
+func geocentricToGeodetic(e Ellipsoid, X float64, Y float64, Z float64) (float64, float64, float64) {
+	es := e.es()
+	p := math.Hypot(X, Y)
+	lam := math.Atan2(Y, X)
+
+	// iterate, converges to well under a mm in a handful of passes
+	phi := math.Atan2(Z, p*(1-es))
+	var N, h float64
+	for i := 0; i < 10; i++ {
+		N = e.A / math.Sqrt(1-es*math.Sin(phi)*math.Sin(phi))
+		h = p/math.Cos(phi) - N
+		next := math.Atan2(Z, p*(1-es*N/(N+h)))
+		if math.Abs(next-phi) < 1e-12 {
+			phi = next
+			break
+		}
+		phi = next
+	}
+
+	return lam * rad2deg, phi * rad2deg, h
+}
+
+// webMercator ... EPSG:3857, spherical mercator of WGS84 lon lat
+type webMercator struct{}
+
+func (webMercator) Forward(lon float64, lat float64) (float64, float64) {
+	return lonLatTo3857(lon, lat)
+}
+
+func (webMercator) Inverse(x float64, y float64) (float64, float64) {
+	return webMercatorTo4326(x, y)
+}
+
+// transverseMercator ... ellipsoidal transverse mercator (USGS / Snyder series), UTM and most state plane
+type transverseMercator struct {
+	e    Ellipsoid
+	lat0 float64
+	lon0 float64
+	k0   float64
+	fe   float64
+	fn   float64
+}
+
+// meridianArc is the distance along the meridian from the equator to phi
+func meridianArc(e Ellipsoid, phi float64) float64 {
+	es := e.es()
+	e4 := es * es
+	e6 := e4 * es
+	return e.A * ((1-es/4-3*e4/64-5*e6/256)*phi -
+		(3*es/8+3*e4/32+45*e6/1024)*math.Sin(2*phi) +
+		(15*e4/256+45*e6/1024)*math.Sin(4*phi) -
+		(35*e6/3072)*math.Sin(6*phi))
+}
+
+func (p transverseMercator) Forward(lon float64, lat float64) (float64, float64) {
+	es := p.e.es()
+	ep2 := es / (1 - es)
+	phi := lat * deg2rad
+	lam := adjustLon(lon-p.lon0) * deg2rad
+
+	sin, cos, tan := math.Sin(phi), math.Cos(phi), math.Tan(phi)
+	N := p.e.A / math.Sqrt(1-es*sin*sin)
+	T := tan * tan
+	C := ep2 * cos * cos
+	A := lam * cos
+	M := meridianArc(p.e, phi)
+	M0 := meridianArc(p.e, p.lat0*deg2rad)
+
+	x := p.k0 * N * (A + (1-T+C)*math.Pow(A, 3)/6 +
+		(5-18*T+T*T+72*C-58*ep2)*math.Pow(A, 5)/120)
+	y := p.k0 * (M - M0 + N*tan*(A*A/2+
+		(5-T+9*C+4*C*C)*math.Pow(A, 4)/24+
+		(61-58*T+T*T+600*C-330*ep2)*math.Pow(A, 6)/720))
+
+	return x + p.fe, y + p.fn
+}
+
+func (p transverseMercator) Inverse(x float64, y float64) (float64, float64) {
+	es := p.e.es()
+	ep2 := es / (1 - es)
+	x -= p.fe
+	y -= p.fn
+
+	// footpoint latitude
+	M := meridianArc(p.e, p.lat0*deg2rad) + y/p.k0
+	mu := M / (p.e.A * (1 - es/4 - 3*es*es/64 - 5*es*es*es/256))
+	e1 := (1 - math.Sqrt(1-es)) / (1 + math.Sqrt(1-es))
+	phi1 := mu + (3*e1/2-27*math.Pow(e1, 3)/32)*math.Sin(2*mu) +
+		(21*e1*e1/16-55*math.Pow(e1, 4)/32)*math.Sin(4*mu) +
+		(151*math.Pow(e1, 3)/96)*math.Sin(6*mu) +
+		(1097*math.Pow(e1, 4)/512)*math.Sin(8*mu)
+
+	sin, cos, tan := math.Sin(phi1), math.Cos(phi1), math.Tan(phi1)
+	C1 := ep2 * cos * cos
+	T1 := tan * tan
+	N1 := p.e.A / math.Sqrt(1-es*sin*sin)
+	R1 := p.e.A * (1 - es) / math.Pow(1-es*sin*sin, 1.5)
+	D := x / (N1 * p.k0)
+
+	phi := phi1 - (N1*tan/R1)*(D*D/2-
+		(5+3*T1+10*C1-4*C1*C1-9*ep2)*math.Pow(D, 4)/24+
+		(61+90*T1+298*C1+45*T1*T1-252*ep2-3*C1*C1)*math.Pow(D, 6)/720)
+	lam := (D - (1+2*T1+C1)*math.Pow(D, 3)/6 +
+		(5-2*C1+28*T1-3*C1*C1+8*ep2+24*T1*T1)*math.Pow(D, 5)/120) / cos
+
+	return adjustLon(p.lon0 + lam*rad2deg), phi * rad2deg
+}
+
+// lambertConformalConic ... ellipsoidal LCC, 2SP or (with lat1 == lat2 == lat0) 1SP with k0
+type lambertConformalConic struct {
+	e    Ellipsoid
+	lat1 float64
+	lat2 float64
+	lat0 float64
+	lon0 float64
+	k0   float64
+	fe   float64
+	fn   float64
+}
+
+// conformalM is Snyder's m, the radius of the parallel over a
+func conformalM(es float64, phi float64) float64 {
+	return math.Cos(phi) / math.Sqrt(1-es*math.Sin(phi)*math.Sin(phi))
+}
+
+// conformalT is Snyder's t, used by the conformal conic and the polar stereographic
+func conformalT(es float64, phi float64) float64 {
+	e := math.Sqrt(es)
+	sin := math.Sin(phi)
+	return math.Tan(math.Pi/4-phi/2) / math.Pow((1-e*sin)/(1+e*sin), e/2)
+}
+
+// phiFromT inverts conformalT by iteration
+func phiFromT(es float64, t float64) float64 {
+	e := math.Sqrt(es)
+	phi := math.Pi/2 - 2*math.Atan(t)
+	for i := 0; i < 15; i++ {
+		sin := math.Sin(phi)
+		next := math.Pi/2 - 2*math.Atan(t*math.Pow((1-e*sin)/(1+e*sin), e/2))
+		if math.Abs(next-phi) < 1e-12 {
+			return next
+		}
+		phi = next
+	}
+	return phi
+}
+
+// constants returns n, F*a*k0 and rho0 of the cone
+func (p lambertConformalConic) constants() (float64, float64, float64) {
+	es := p.e.es()
+	phi1, phi2, phi0 := p.lat1*deg2rad, p.lat2*deg2rad, p.lat0*deg2rad
+	m1, m2 := conformalM(es, phi1), conformalM(es, phi2)
+	t1, t2, t0 := conformalT(es, phi1), conformalT(es, phi2), conformalT(es, phi0)
+
+	n := math.Sin(phi1)
+	if p.lat1 != p.lat2 {
+		n = (math.Log(m1) - math.Log(m2)) / (math.Log(t1) - math.Log(t2))
+	}
+
+	k0 := p.k0
+	if k0 == 0 {
+		k0 = 1
+	}
+
+	aF := p.e.A * k0 * m1 / (n * math.Pow(t1, n))
+	return n, aF, aF * math.Pow(t0, n)
+}
+
+func (p lambertConformalConic) Forward(lon float64, lat float64) (float64, float64) {
+	n, aF, rho0 := p.constants()
+	rho := aF * math.Pow(conformalT(p.e.es(), lat*deg2rad), n)
+	theta := n * adjustLon(lon-p.lon0) * deg2rad
+
+	return p.fe + rho*math.Sin(theta), p.fn + rho0 - rho*math.Cos(theta)
+}
+
+func (p lambertConformalConic) Inverse(x float64, y float64) (float64, float64) {
+	n, aF, rho0 := p.constants()
+	x -= p.fe
+	y = rho0 - (y - p.fn)
+
+	sign := math.Copysign(1, n)
+	rho := sign * math.Hypot(x, y)
+	theta := math.Atan2(sign*x, sign*y)
+
+	t := math.Pow(rho/aF, 1/n)
+	phi := phiFromT(p.e.es(), t)
+
+	return adjustLon(p.lon0 + theta/n*rad2deg), phi * rad2deg
+}
+
+// albersEqualArea ... ellipsoidal albers conic equal area
+type albersEqualArea struct {
+	e    Ellipsoid
+	lat1 float64
+	lat2 float64
+	lat0 float64
+	lon0 float64
+	fe   float64
+	fn   float64
+}
+
+// authalicQ is Snyder's q for the equal area projections
+func authalicQ(es float64, phi float64) float64 {
+	e := math.Sqrt(es)
+	sin := math.Sin(phi)
+	return (1 - es) * (sin/(1-es*sin*sin) - (1/(2*e))*math.Log((1-e*sin)/(1+e*sin)))
+}
+
+// constants returns n, C and rho0 of the cone
+func (p albersEqualArea) constants() (float64, float64, float64) {
+	es := p.e.es()
+	phi1, phi2, phi0 := p.lat1*deg2rad, p.lat2*deg2rad, p.lat0*deg2rad
+	m1, m2 := conformalM(es, phi1), conformalM(es, phi2)
+	q1, q2, q0 := authalicQ(es, phi1), authalicQ(es, phi2), authalicQ(es, phi0)
+
+	n := math.Sin(phi1)
+	if p.lat1 != p.lat2 {
+		n = (m1*m1 - m2*m2) / (q2 - q1)
+	}
+	C := m1*m1 + n*q1
+	rho0 := p.e.A * math.Sqrt(C-n*q0) / n
+
+	return n, C, rho0
+}
+
+func (p albersEqualArea) Forward(lon float64, lat float64) (float64, float64) {
+	n, C, rho0 := p.constants()
+	rho := p.e.A * math.Sqrt(C-n*authalicQ(p.e.es(), lat*deg2rad)) / n
+	theta := n * adjustLon(lon-p.lon0) * deg2rad
+
+	return p.fe + rho*math.Sin(theta), p.fn + rho0 - rho*math.Cos(theta)
+}
+
+func (p albersEqualArea) Inverse(x float64, y float64) (float64, float64) {
+	es := p.e.es()
+	e := math.Sqrt(es)
+	n, C, rho0 := p.constants()
+	x -= p.fe
+	y = rho0 - (y - p.fn)
+
+	sign := math.Copysign(1, n)
+	rho := sign * math.Hypot(x, y)
+	theta := math.Atan2(sign*x, sign*y)
+	q := (C - rho*rho*n*n/(p.e.A*p.e.A)) / n
+
+	// iterate on the latitude
+	phi := math.Asin(math.Max(-1, math.Min(1, q/2)))
+	for i := 0; i < 15; i++ {
+		sin, cos := math.Sin(phi), math.Cos(phi)
+		dphi := math.Pow(1-es*sin*sin, 2) / (2 * cos) *
+			(q/(1-es) - sin/(1-es*sin*sin) + (1/(2*e))*math.Log((1-e*sin)/(1+e*sin)))
+		phi += dphi
+		if math.Abs(dphi) < 1e-12 {
+			break
+		}
+	}
+
+	return adjustLon(p.lon0 + theta/n*rad2deg), phi * rad2deg
+}
+
+// polarStereographic ... ellipsoidal polar stereographic
+// variant A is scaled by k0 at the pole, variant B by a latitude of true scale (latTs)
+type polarStereographic struct {
+	e     Ellipsoid
+	south bool
+	latTs float64 // variant B, used when k0 is 0
+	k0    float64 // variant A
+	lon0  float64
+	fe    float64
+	fn    float64
+}
+
+// scale returns the multiplier taking Snyder's t to rho
+func (p polarStereographic) scale() float64 {
+	es := p.e.es()
+	e := math.Sqrt(es)
+
+	if p.k0 != 0 {
+		return 2 * p.e.A * p.k0 / math.Sqrt(math.Pow(1+e, 1+e)*math.Pow(1-e, 1-e))
+	}
+
+	phic := math.Abs(p.latTs) * deg2rad
+	return p.e.A * conformalM(es, phic) / conformalT(es, phic)
+}
+
+func (p polarStereographic) Forward(lon float64, lat float64) (float64, float64) {
+	phi := lat * deg2rad
+	lam := adjustLon(lon-p.lon0) * deg2rad
+	if p.south {
+		phi = -phi
+	}
+
+	rho := p.scale() * conformalT(p.e.es(), phi)
+
+	if p.south {
+		return p.fe + rho*math.Sin(lam), p.fn + rho*math.Cos(lam)
+	}
+	return p.fe + rho*math.Sin(lam), p.fn - rho*math.Cos(lam)
+}
+
+func (p polarStereographic) Inverse(x float64, y float64) (float64, float64) {
+	x -= p.fe
+	y -= p.fn
+
+	rho := math.Hypot(x, y)
+	phi := phiFromT(p.e.es(), rho/p.scale())
+
+	if p.south {
+		return adjustLon(p.lon0 + math.Atan2(x, y)*rad2deg), -phi * rad2deg
+	}
+	return adjustLon(p.lon0 + math.Atan2(x, -y)*rad2deg), phi * rad2deg
+}
+
+// adjustLon wraps a longitude in degrees to +-180
+func adjustLon(lon float64) float64 {
+	for lon > 180 {
+		lon -= 360
+	}
+	for lon < -180 {
+		lon += 360
+	}
+	return lon
+}
@@ -0,0 +1,139 @@
+package convert
+
+import (
+	"math"
+	"testing"
+)
+
+// projectionCase is a worked example: lon lat in, x y expected
+type projectionCase struct {
+	name      string
+	proj      Projection
+	lon, lat  float64
+	x, y      float64
+	tolerance float64
+}
+
+func TestProjections(t *testing.T) {
+
+	// the worked examples of Snyder's "Map Projections - A Working Manual", and the OS guide
+	cases := []projectionCase{
+		{"snyder transverse mercator", transverseMercator{e: clarke66, lon0: -75, k0: 0.9996}, -73.5, 40.5, 127106.5, 4484124.4, 0.5},
+		{"os national grid", transverseMercator{e: airy1830, lat0: 49, lon0: -2, k0: 0.9996012717, fe: 400000, fn: -100000}, 1.717921583, 52.657570306, 651409.903, 313177.270, 0.01},
+		{"snyder lambert conformal conic", lambertConformalConic{e: clarke66, lat1: 33, lat2: 45, lat0: 23, lon0: -96}, -75, 35, 1894410.9, 1564649.5, 0.5},
+		{"snyder albers equal area", albersEqualArea{e: clarke66, lat1: 29.5, lat2: 45.5, lat0: 23, lon0: -96}, -75, 35, 1885472.7, 1535925.0, 0.5},
+		{"snyder polar stereographic", polarStereographic{e: intl1924, south: true, latTs: -71, lon0: -100}, 150, -75, -1540033.6, -560526.4, 0.5},
+	}
+
+	for _, c := range cases {
+		x, y := c.proj.Forward(c.lon, c.lat)
+		if math.Abs(x-c.x) > c.tolerance || math.Abs(y-c.y) > c.tolerance {
+			t.Errorf("%s forward: got %.3f, %.3f expected %.3f, %.3f\n", c.name, x, y, c.x, c.y)
+		}
+
+		lon, lat := c.proj.Inverse(c.x, c.y)
+		if math.Abs(lon-c.lon) > 1e-5 || math.Abs(lat-c.lat) > 1e-5 {
+			t.Errorf("%s inverse: got %.7f, %.7f expected %.7f, %.7f\n", c.name, lon, lat, c.lon, c.lat)
+		}
+	}
+}
+
+func TestEPSGRoundTrip(t *testing.T) {
+
+	// every registered crs must survive a round trip near its area of use
+	near := map[int][2]float64{
+		32612: {-112.16, 34.06},
+		32755: {147.3, -42.9},
+		26908: {-135.5, 63.9},
+		26711: {-117.1, 34.2},
+		20355: {146.1, -38.1},
+		27700: {-1.5, 53.8},
+		3577:  {133.9, -23.7},
+		3413:  {-45.2, 75.1},
+		3031:  {166.7, -77.8},
+		32661: {10.1, 84.3},
+		2227:  {-121.9, 37.3},
+		26743: {-121.9, 37.3},
+		2263:  {-73.8, 40.7},
+	}
+
+	for code, lonlat := range near {
+		crs, err := LookupEPSG(code)
+		if err != nil {
+			t.Errorf(err.Error())
+			continue
+		}
+
+		x, y := crs.FromLonLat(lonlat[0], lonlat[1])
+		lon, lat := crs.ToLonLat(x, y)
+
+		if math.Abs(lon-lonlat[0]) > 1e-7 || math.Abs(lat-lonlat[1]) > 1e-7 {
+			t.Errorf("EPSG:%d round trip drifted: %v became %.8f, %.8f\n", code, lonlat, lon, lat)
+		}
+	}
+}
+
+func TestUTMToWebMercator(t *testing.T) {
+
+	// tests/fake/testshape3D.geojson is tests/fake/testshape.geojson in UTM zone 12N, with Z
+	utm := Options{SRS: 32612}
+	coord, err := utm.checkCoords([]float64{392665.586726718058344, 3769757.660203891806304, 637.3851318359375})
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	lonlat := Options{SRS: 4326}
+	expected, _ := lonlat.checkCoords([]float64{-112.163114178415739, 34.063054773258038, 637.3851318359375})
+
+	if math.Abs(coord[0]-expected[0]) > 1 || math.Abs(coord[1]-expected[1]) > 1 {
+		t.Errorf("utm 12N vertex landed at %v, expected %v\n", coord, expected)
+	}
+
+	// z must come through untouched
+	if coord[2] != 637.3851318359375 {
+		t.Errorf("utm z was modified: %v\n", coord[2])
+	}
+}
+
+func TestHelmert(t *testing.T) {
+
+	// an OSGB36 lon lat shifts roughly 100m west onto WGS84, as the greenwich meridian does
+	crs, _ := LookupEPSG(4277)
+	lon, lat := crs.ToLonLat(-1.5, 53.8)
+	west := -(lon + 1.5) * deg2rad * wgs84.A * math.Cos(lat*deg2rad)
+	if west < 50 || west > 150 {
+		t.Errorf("OSGB36 to WGS84 shifted %.1fm west: %.6f, %.6f\n", west, lon, lat)
+	}
+
+	// and back again
+	backlon, backlat := crs.FromLonLat(lon, lat)
+	if math.Abs(backlon+1.5) > 1e-7 || math.Abs(backlat-53.8) > 1e-7 {
+		t.Errorf("OSGB36 helmert round trip drifted: %.8f, %.8f\n", backlon, backlat)
+	}
+}
+
+func TestLookupCRSName(t *testing.T) {
+
+	names := map[string]int{
+		"urn:ogc:def:crs:OGC:1.3:CRS84":               4326,
+		"urn:ogc:def:crs:EPSG::26911":                 26911,
+		"urn:ogc:def:crs:EPSG:6.6:3857":               3857,
+		"EPSG:900913":                                 3857,
+		"http://www.opengis.net/def/crs/EPSG/0/32612": 32612,
+	}
+
+	for name, code := range names {
+		crs, err := LookupCRSName(name)
+		if err != nil {
+			t.Errorf(err.Error())
+			continue
+		}
+		if crs.EPSG != code {
+			t.Errorf("%s resolved to EPSG:%d expected EPSG:%d\n", name, crs.EPSG, code)
+		}
+	}
+
+	if _, err := LookupCRSName("urn:ogc:def:crs:OGC:1.3:CRS27"); err == nil {
+		t.Errorf("CRS27 should not resolve\n")
+	}
+}
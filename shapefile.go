@@ -0,0 +1,613 @@
+package convert
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	geojson "github.com/paulmach/go.geojson"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+)
+
+// shapefile shape types
+const (
+	shapeNull        = 0
+	shapePoint       = 1
+	shapePolyLine    = 3
+	shapePolygon     = 5
+	shapeMultiPoint  = 8
+	shapePointZ      = 11
+	shapePolyLineZ   = 13
+	shapePolygonZ    = 15
+	shapeMultiPointZ = 18
+	shapePointM      = 21
+	shapePolyLineM   = 23
+	shapePolygonM    = 25
+	shapeMultiPointM = 28
+	shapeMultiPatch  = 31
+)
+
+// multipatch part types
+const (
+	patchTriangleStrip = 0
+	patchTriangleFan   = 1
+	patchOuterRing     = 2
+	patchInnerRing     = 3
+	patchFirstRing     = 4
+	patchRing          = 5
+)
+
+// shapeRecord ... a record of a .shp, its points by part, plus the part types of a multipatch
+type shapeRecord struct {
+	number    int
+	shapeType int
+	parts     [][][]float64 // x y, or x y z for the Z types
+	partTypes []int
+}
+
+// shapefileLayer ... the files of one shapefile, shx dbf and prj may be nil
+type shapefileLayer struct {
+	name string
+	shp  io.Reader
+	shx  io.Reader
+	dbf  io.Reader
+	prj  io.Reader
+}
+
+// DatasetFromShapefile converts a zipped shapefile, every .shp in the zip along with its
+// .shx, .dbf and .prj.  The .prj declares the srs, unless Options.SRS does.  Without either,
+// Options.GuessSRS opts in to guessing it from coordinate magnitude.
+func DatasetFromShapefile(contents io.Reader, opts ...Options) (*Datasets, error) {
+	raw, err := ioutil.ReadAll(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("[DatasetFromShapefile] in pkg [convert] encountered: %v", err)
+	}
+
+	// the files of each layer, by name without the extension
+	files := make(map[string]*zip.File)
+	var names []string
+	for _, f := range archive.File {
+		if strings.HasPrefix(path.Base(f.Name), ".") {
+			continue
+		}
+
+		ext := strings.ToLower(path.Ext(f.Name))
+		base := strings.TrimSuffix(f.Name, path.Ext(f.Name))
+		files[base+ext] = f
+
+		if ext == ".shp" {
+			names = append(names, base)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		return nil, errors.New("no .shp in the zip")
+	}
+
+	var layers []shapefileLayer
+	for _, name := range names {
+		layer := shapefileLayer{name: path.Base(name)}
+		for ext, reader := range map[string]*io.Reader{".shp": &layer.shp, ".shx": &layer.shx, ".dbf": &layer.dbf, ".prj": &layer.prj} {
+			f, ok := files[name+ext]
+			if !ok {
+				continue
+			}
+
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			*reader = rc
+		}
+		layers = append(layers, layer)
+	}
+
+	return datasetFromShapefiles(layers, opts)
+}
+
+// DatasetFromShapefileParts converts a shapefile from its separate files, shx, dbf and prj
+// may be nil.  The .prj declares the srs, unless Options.SRS does.
+func DatasetFromShapefileParts(shp io.Reader, shx io.Reader, dbf io.Reader, prj io.Reader, opts ...Options) (*Datasets, error) {
+	return datasetFromShapefiles([]shapefileLayer{{shp: shp, shx: shx, dbf: dbf, prj: prj}}, opts)
+}
+
+// datasetFromShapefiles converts the layers into one dataset, naming the layer of each feature
+// in its attributes when there's more than one
+func datasetFromShapefiles(layers []shapefileLayer, opts []Options) (*Datasets, error) {
+	var err error
+
+	// the layers must agree with each other, and with the declared srs
+	for _, layer := range layers {
+		if layer.prj == nil {
+			continue
+		}
+
+		if opts, err = shapefileOptions(layer.prj, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// ensure demvrt is set, unless an elevation provider is declared
+	options, err := resolveOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var outdataset Datasets
+	container := initExtentContainer(options)
+
+	for _, layer := range layers {
+		if err := parseShapefileLayer(layer, len(layers) > 1, &outdataset, container); err != nil {
+			close(container.ch)
+			return nil, fmt.Errorf("[ParseShapefile] in pkg [convert] layer %s encountered: %v", layer.name, err)
+		}
+	}
+
+	// close the BBOXlistener goroutine
+	close(container.ch)
+
+	// make sure there's valid features in the dataset
+	if len(outdataset.Points) == 0 && len(outdataset.Lines) == 0 && len(outdataset.Shapes) == 0 {
+		return nil, errors.New("no valid features in dataset")
+	}
+
+	// configure the center point... in 4326
+	c, err := getCenter(container)
+	if err != nil {
+		return nil, err
+	}
+	outdataset.Center = append(outdataset.Center, c)
+
+	// configure the s2 array... in 4326
+	outdataset.S2 = s2covering(container)
+
+	// record how the dataset was read
+	outdataset.Metadata = container.options().metadata()
+
+	return &outdataset, nil
+}
+
+// shapefileOptions declares the crs of a .prj in the options, see declareCRS
+func shapefileOptions(prj io.Reader, opts []Options) ([]Options, error) {
+	wkt, err := ioutil.ReadAll(prj)
+	if err != nil {
+		return nil, err
+	}
+
+	crs, err := LookupPRJ(string(wkt))
+	if err != nil {
+		// only needed if nothing else says where the coordinates are
+		if len(opts) > 0 && (opts[0].SRS != 0 || opts[0].MineGrid != nil) {
+			return opts, nil
+		}
+		return nil, fmt.Errorf("%v, declare Options.SRS", err)
+	}
+
+	return declareCRS(crs, "shapefile prj", opts)
+}
+
+// declareCRS declares the crs a file carries in the options, unless the caller declared a mine
+// grid, whose srs is that of the grid and not of the local coordinates.  A crs that conflicts
+// with the declared srs is an error.
+func declareCRS(crs *CRS, source string, opts []Options) ([]Options, error) {
+	var o Options
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if o.MineGrid != nil {
+		return opts, nil
+	}
+
+	if o.SRS != 0 {
+		declared, err := LookupEPSG(o.SRS)
+		if err != nil {
+			return nil, err
+		}
+		if declared != crs {
+			return nil, fmt.Errorf("%s %s conflicts with the declared srs %s", source, crs.Name, declared.Name)
+		}
+	}
+
+	o.SRS = crs.EPSG
+	return []Options{o}, nil
+}
+
+// parseShapefileLayer reads a layer's shapes and attributes, appending each feature to the dataset
+func parseShapefileLayer(layer shapefileLayer, named bool, outdataset *Datasets, container *ExtentContainer) error {
+	if layer.shp == nil {
+		return errors.New("missing the .shp")
+	}
+
+	records, err := readShapefile(layer.shp, layer.shx)
+	if err != nil {
+		return err
+	}
+
+	var table *dbfTable
+	if layer.dbf != nil {
+		if table, err = readDBF(layer.dbf); err != nil {
+			return err
+		}
+	}
+
+	for i, record := range records {
+		properties := make(map[string]interface{})
+		var headers []string
+
+		// the dbf has a row per record, in the same order
+		if table != nil && i < len(table.rows) {
+			if table.rows[i] == nil {
+				continue
+			}
+			properties = table.properties(table.rows[i])
+			headers = table.headers()
+		}
+
+		if named {
+			properties["layer"] = layer.name
+			headers = append(headers, "layer")
+		}
+
+		if err := parseShapeRecord(&record, properties, headers, outdataset, container); err != nil {
+			fmt.Printf("NonFatal [parseShapeRecord] record %d encountered %v\n", record.number, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// parseShapeRecord converts a shapefile record and its dbf properties into features, as a
+// geojson feature would be.  Multipatch triangles become a Shapes mesh.
+func parseShapeRecord(record *shapeRecord, properties map[string]interface{}, headers []string, outdataset *Datasets, container *ExtentContainer) error {
+	var geometries []*geojson.Geometry
+	switch record.shapeType {
+	case shapeNull:
+		return nil
+
+	case shapePoint, shapePointZ, shapePointM, shapeMultiPoint, shapeMultiPointZ, shapeMultiPointM:
+		// a multipoint becomes a point per point
+		for _, point := range record.parts[0] {
+			geometries = append(geometries, geojson.NewPointGeometry(point))
+		}
+
+	case shapePolyLine, shapePolyLineZ, shapePolyLineM:
+		if len(record.parts) == 1 {
+			geometries = append(geometries, geojson.NewLineStringGeometry(record.parts[0]))
+		} else {
+			geometries = append(geometries, geojson.NewMultiLineStringGeometry(record.parts...))
+		}
+
+	case shapePolygon, shapePolygonZ, shapePolygonM:
+		polygons := ringsToPolygons(record.parts)
+		if len(polygons) == 1 {
+			geometries = append(geometries, geojson.NewPolygonGeometry(polygons[0]))
+		} else if len(polygons) > 1 {
+			geometries = append(geometries, geojson.NewMultiPolygonGeometry(polygons...))
+		}
+
+	case shapeMultiPatch:
+		geometry, err := parseMultiPatch(record, properties, headers, outdataset, container)
+		if err != nil {
+			return err
+		}
+		if geometry != nil {
+			geometries = append(geometries, geometry)
+		}
+
+	default:
+		return fmt.Errorf("unsupported shape type %d", record.shapeType)
+	}
+
+	return parseFeatureGeometries(geometries, properties, headers, outdataset, container)
+}
+
+// ringsToPolygons groups shapefile rings into polygons, an outer ring is clockwise and is
+// followed by the counter clockwise holes within it
+func ringsToPolygons(rings [][][]float64) [][][][]float64 {
+	var polygons [][][][]float64
+	var holes [][][]float64
+
+	for _, ring := range rings {
+		if len(ring) < 4 {
+			continue
+		}
+		if ringArea(ring) <= 0 {
+			polygons = append(polygons, [][][]float64{ring})
+			continue
+		}
+		holes = append(holes, ring)
+	}
+
+	// each hole goes in the first polygon to contain it, or is an outer ring wound backwards
+	for _, hole := range holes {
+		placed := false
+		for i, polygon := range polygons {
+			if planar.RingContains(toOrbRing(polygon[0]), orb.Point{hole[0][0], hole[0][1]}) {
+				polygons[i] = append(polygon, hole)
+				placed = true
+				break
+			}
+		}
+
+		if !placed {
+			polygons = append(polygons, [][][]float64{hole})
+		}
+	}
+
+	return polygons
+}
+
+// ringArea is the signed area of a ring, negative when clockwise
+func ringArea(ring [][]float64) float64 {
+	var area float64
+	for i := 0; i < len(ring)-1; i++ {
+		area += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return area / 2
+}
+
+// toOrbRing converts a ring for the planar tests
+func toOrbRing(ring [][]float64) orb.Ring {
+	r := make(orb.Ring, len(ring))
+	for i, point := range ring {
+		r[i] = orb.Point{point[0], point[1]}
+	}
+	return r
+}
+
+// parseMultiPatch appends the triangles of a multipatch as a Shapes mesh, returning its rings,
+// if any, as a polygon geometry
+func parseMultiPatch(record *shapeRecord, properties map[string]interface{}, headers []string, outdataset *Datasets, container *ExtentContainer) (*geojson.Geometry, error) {
+	var vertices [][]float64
+	var indices []int
+	var rings [][][]float64
+
+	for i, part := range record.parts {
+		switch record.partTypes[i] {
+		case patchTriangleStrip:
+			for j := 2; j < len(part); j++ {
+				// alternate the winding, so every triangle faces the same way
+				a, b := j-2, j-1
+				if j%2 == 1 {
+					a, b = b, a
+				}
+				indices = append(indices, len(vertices)+a, len(vertices)+b, len(vertices)+j)
+			}
+			vertices = append(vertices, part...)
+
+		case patchTriangleFan:
+			for j := 2; j < len(part); j++ {
+				indices = append(indices, len(vertices), len(vertices)+j-1, len(vertices)+j)
+			}
+			vertices = append(vertices, part...)
+
+		default:
+			rings = append(rings, part)
+		}
+	}
+
+	if len(vertices) > 0 {
+		// vertex by vertex, a mesh is never densified
+		var parsed [][]float64
+		for _, vertex := range vertices {
+			point, err := ParseNestedGeom(container, vertex)
+			if err != nil {
+				return nil, err
+			}
+			parsed = append(parsed, point.([]float64))
+		}
+
+		newfeature := Shapes{StyleType: "multipatch"}
+		gfeature := FeatureInfo{Geojson: geojson.Feature{Properties: properties}}
+		newfeature.Attributes = ParseGEOJSONAttributes(&gfeature)
+		sortAttributes(newfeature.Attributes, headers)
+		newfeature.ID, newfeature.Name = gfeature.ID, gfeature.Name
+		if gfeature.StyleType != "" {
+			newfeature.StyleType = gfeature.StyleType
+		}
+		newfeature.Vertices = parsed
+		newfeature.Indices = indices
+		outdataset.Shapes = append(outdataset.Shapes, newfeature)
+	}
+
+	if len(rings) == 0 {
+		return nil, nil
+	}
+
+	// outer, inner, first and other rings all take their holes by winding
+	polygons := ringsToPolygons(rings)
+	if len(polygons) == 1 {
+		return geojson.NewPolygonGeometry(polygons[0]), nil
+	}
+	return geojson.NewMultiPolygonGeometry(polygons...), nil
+}
+
+// readShapefile reads the records of a .shp, at the offsets of the .shx if there is one
+func readShapefile(shp io.Reader, shx io.Reader) ([]shapeRecord, error) {
+	raw, err := ioutil.ReadAll(shp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) < 100 || binary.BigEndian.Uint32(raw[0:4]) != 9994 {
+		return nil, errors.New("not a shapefile")
+	}
+
+	// record offsets, from the index or by walking the records
+	var offsets []int
+	if shx != nil {
+		index, err := ioutil.ReadAll(shx)
+		if err != nil {
+			return nil, err
+		}
+		for i := 100; i+8 <= len(index); i += 8 {
+			offsets = append(offsets, int(binary.BigEndian.Uint32(index[i:i+4]))*2)
+		}
+	} else {
+		for offset := 100; offset+8 <= len(raw); {
+			offsets = append(offsets, offset)
+			offset += 8 + int(binary.BigEndian.Uint32(raw[offset+4:offset+8]))*2
+		}
+	}
+
+	var records []shapeRecord
+	for _, offset := range offsets {
+		if offset+8 > len(raw) {
+			return nil, fmt.Errorf("shapefile record at byte %d is beyond the end", offset)
+		}
+
+		number := int(binary.BigEndian.Uint32(raw[offset : offset+4]))
+		length := int(binary.BigEndian.Uint32(raw[offset+4:offset+8])) * 2
+		if offset+8+length > len(raw) {
+			return nil, fmt.Errorf("shapefile record %d is truncated", number)
+		}
+
+		record, err := readShapeRecord(raw[offset+8 : offset+8+length])
+		if err != nil {
+			return nil, fmt.Errorf("shapefile record %d: %v", number, err)
+		}
+		record.number = number
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// shapeReader ... reads the little endian content of a record, remembering if it ran out
+type shapeReader struct {
+	content []byte
+	offset  int
+	short   bool
+}
+
+func (r *shapeReader) int32() int {
+	if r.offset+4 > len(r.content) {
+		r.short = true
+		return 0
+	}
+	v := int32(binary.LittleEndian.Uint32(r.content[r.offset:]))
+	r.offset += 4
+	return int(v)
+}
+
+func (r *shapeReader) float64() float64 {
+	if r.offset+8 > len(r.content) {
+		r.short = true
+		return math.NaN()
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(r.content[r.offset:]))
+	r.offset += 8
+	return v
+}
+
+func (r *shapeReader) skip(n int) {
+	r.offset += n
+}
+
+// readShapeRecord reads the content of a record, the M values are dropped
+func readShapeRecord(content []byte) (shapeRecord, error) {
+	r := &shapeReader{content: content}
+	record := shapeRecord{shapeType: r.int32()}
+
+	hasZ := false
+	switch record.shapeType {
+	case shapePointZ, shapeMultiPointZ, shapePolyLineZ, shapePolygonZ, shapeMultiPatch:
+		hasZ = true
+	}
+
+	switch record.shapeType {
+	case shapeNull:
+		return record, nil
+
+	case shapePoint, shapePointZ, shapePointM:
+		point := []float64{r.float64(), r.float64()}
+		if hasZ {
+			point = append(point, r.float64())
+		}
+		record.parts = [][][]float64{{point}}
+
+	case shapeMultiPoint, shapeMultiPointZ, shapeMultiPointM:
+		r.skip(32)
+		n := r.int32()
+		if r.short || n < 0 || n > len(content)/16 {
+			return record, errors.New("corrupt multipoint")
+		}
+
+		points := readShapePoints(r, n, hasZ)
+		record.parts = [][][]float64{points}
+
+	case shapePolyLine, shapePolyLineZ, shapePolyLineM, shapePolygon, shapePolygonZ, shapePolygonM, shapeMultiPatch:
+		r.skip(32)
+		numParts, numPoints := r.int32(), r.int32()
+		if r.short || numParts < 0 || numPoints < 0 || numParts > len(content)/4 || numPoints > len(content)/16 {
+			return record, errors.New("corrupt parts")
+		}
+
+		starts := make([]int, numParts)
+		for i := range starts {
+			starts[i] = r.int32()
+		}
+
+		if record.shapeType == shapeMultiPatch {
+			record.partTypes = make([]int, numParts)
+			for i := range record.partTypes {
+				record.partTypes[i] = r.int32()
+			}
+		}
+
+		points := readShapePoints(r, numPoints, hasZ)
+		for i, start := range starts {
+			end := numPoints
+			if i+1 < numParts {
+				end = starts[i+1]
+			}
+			if start < 0 || start > end || end > numPoints {
+				return record, errors.New("corrupt part index")
+			}
+			record.parts = append(record.parts, points[start:end])
+		}
+
+	default:
+		return record, fmt.Errorf("unsupported shape type %d", record.shapeType)
+	}
+
+	if r.short {
+		return record, errors.New("record is truncated")
+	}
+
+	return record, nil
+}
+
+// readShapePoints reads n x y points, then their z range and z values for the Z types
+func readShapePoints(r *shapeReader, n int, hasZ bool) [][]float64 {
+	points := make([][]float64, n)
+	for i := range points {
+		points[i] = []float64{r.float64(), r.float64()}
+	}
+
+	if hasZ {
+		r.skip(16)
+		for i := range points {
+			points[i] = append(points[i], r.float64())
+		}
+	}
+
+	return points
+}
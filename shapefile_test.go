@@ -0,0 +1,149 @@
+package convert
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+const (
+	//shapefile testing datasets
+	shapefilezip = "tests/shapefile/delivery.zip"
+	samplesshp   = "tests/shapefile/samples"
+)
+
+func TestShapefileParts(t *testing.T) {
+
+	var files []*os.File
+	for _, ext := range []string{".shp", ".shx", ".dbf", ".prj"} {
+		f, err := os.Open(samplesshp + ext)
+		if err != nil {
+			t.Errorf(err.Error())
+			return
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+
+	// no srs declared, the prj has it
+	results, err := DatasetFromShapefileParts(files[0], files[1], files[2], files[3], Options{Elevation: ConstantProvider{}})
+	if err != nil {
+		t.Errorf("shapefile conversion error for %s: %v\n", samplesshp, err)
+		return
+	}
+
+	if len(results.Points) != 3 {
+		t.Errorf("%s had %d points, expected 3\n", samplesshp, len(results.Points))
+		return
+	}
+
+	utm := Options{SRS: 32612}
+	expected, _ := utm.checkCoords([]float64{392500, 3770000, 1510.5})
+	point := results.Points[0]
+	if point.Points[0] != expected[0] || point.Points[1] != expected[1] || point.Points[2] != expected[2] {
+		t.Errorf("first sample was %v, expected %v\n", point.Points, expected)
+	}
+
+	// dbf fields in order, the name column as the name
+	if point.Name != "S-001" {
+		t.Errorf("first sample was named %q, expected S-001\n", point.Name)
+	}
+	want := []Attribute{{Key: "AU_GPT", Value: "1.25"}, {Key: "SAMPLED", Value: "2023-04-15"}, {Key: "ASSAYED", Value: "true"}}
+	if len(point.Attributes) != len(want) {
+		t.Errorf("first sample attributes were %v, expected %v\n", point.Attributes, want)
+		return
+	}
+	for i, att := range want {
+		if point.Attributes[i] != att {
+			t.Errorf("first sample attribute %d was %v, expected %v\n", i, point.Attributes[i], att)
+		}
+	}
+}
+
+func TestShapefileZip(t *testing.T) {
+
+	data, err := os.Open(shapefilezip)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer data.Close()
+
+	results, err := DatasetFromShapefile(data, Options{SRS: 32612, Elevation: ConstantProvider{Z: 1234}})
+	if err != nil {
+		t.Errorf("shapefile conversion error for %s: %v\n", shapefilezip, err)
+		return
+	}
+
+	// samples, the two part haul road (the other road is deleted), two claims and the pit
+	if len(results.Points) != 3 || len(results.Lines) != 2 || len(results.Shapes) != 3 {
+		t.Errorf("%s had %d points, %d lines and %d shapes, expected 3, 2 and 3\n", shapefilezip, len(results.Points), len(results.Lines), len(results.Shapes))
+		return
+	}
+
+	// a polyline without z is filled from the dem, and knows its layer
+	road := results.Lines[0]
+	if road.Points[0][2] != 1234 {
+		t.Errorf("road z was %v, expected the dem's 1234\n", road.Points[0][2])
+	}
+	layer := ""
+	for _, att := range road.Attributes {
+		if att.Key == "layer" {
+			layer = att.Value
+		}
+	}
+	if layer != "roads" {
+		t.Errorf("road layer was %q, expected roads\n", layer)
+	}
+
+	for _, shape := range results.Shapes {
+		switch {
+		case shape.StyleType == "multipatch":
+			// a fan of six vertices is four triangles
+			if len(shape.Vertices) != 6 || len(shape.Indices) != 12 || shape.Name != "Main pit" {
+				t.Errorf("pit mesh had %d vertices and %d indices, named %q\n", len(shape.Vertices), len(shape.Indices), shape.Name)
+			}
+			if math.Abs(shape.Vertices[0][2]-1400) > 1e-9 {
+				t.Errorf("pit floor was %v, expected 1400\n", shape.Vertices[0][2])
+			}
+
+		case len(shape.Points) == 1 && len(shape.Points[0]) == 2:
+			// the claim with a hole
+			if len(shape.Points[0][0]) != 5 || len(shape.Points[0][1]) != 5 {
+				t.Errorf("claim rings were %v\n", shape.Points[0])
+			}
+
+		case len(shape.Points) == 1 && len(shape.Points[0]) == 1:
+
+		default:
+			t.Errorf("unexpected shape %v\n", shape)
+		}
+	}
+
+	// the prj and the declared srs must agree
+	data.Seek(0, 0)
+	if _, err := DatasetFromShapefile(data, Options{SRS: 4326, Elevation: ConstantProvider{}}); err == nil {
+		t.Errorf("a prj conflicting with the declared srs should be refused\n")
+	}
+}
+
+func TestLookupPRJ(t *testing.T) {
+
+	tests := map[string]int{
+		`PROJCS["WGS 84 / UTM zone 12N",GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]],AUTHORITY["EPSG","6326"]],PRIMEM["Greenwich",0],UNIT["degree",0.0174532925199433]],PROJECTION["Transverse_Mercator"],UNIT["metre",1],AUTHORITY["EPSG","32612"]]`: 32612,
+		`PROJCS["NAD_1983_UTM_Zone_11N",GEOGCS["GCS_North_American_1983",DATUM["D_North_American_1983",SPHEROID["GRS_1980",6378137.0,298.257222101]]],PROJECTION["Transverse_Mercator"],UNIT["Meter",1.0]]`:                                                                                                 26911,
+		`GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`:                                                                                                                                                 4326,
+		`PROJCS["NAD_1983_StatePlane_California_V_FIPS_0405_Feet",GEOGCS["GCS_North_American_1983",DATUM["D_North_American_1983",SPHEROID["GRS_1980",6378137.0,298.257222101]]],PROJECTION["Lambert_Conformal_Conic"],UNIT["Foot_US",0.3048006096012192]]`:                                                  2229,
+	}
+
+	for wkt, code := range tests {
+		crs, err := LookupPRJ(wkt)
+		if err != nil || crs.EPSG != code {
+			t.Errorf("prj %.40s... resolved to %v, %v expected EPSG:%d\n", wkt, crs, err, code)
+		}
+	}
+
+	if _, err := LookupPRJ(`LOCAL_CS["Mine Grid"]`); err == nil {
+		t.Errorf("a local crs should not resolve\n")
+	}
+}
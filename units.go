@@ -0,0 +1,88 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Unit ... a unit of length for inbound coordinates, named as PROJ does
+type Unit string
+
+const (
+	// Meters are assumed when no unit is declared
+	Meters Unit = "m"
+
+	// Feet are international feet, 0.3048m
+	Feet Unit = "ft"
+
+	// USSurveyFeet are US survey feet, 1200/3937m, as most US state plane data
+	USSurveyFeet Unit = "us-ft"
+)
+
+// valid reports an error for an unknown unit
+func (unit Unit) valid() error {
+	switch unit {
+	case "", Meters, Feet, USSurveyFeet:
+		return nil
+	}
+	return fmt.Errorf("unknown unit %q, use m, ft or us-ft", unit)
+}
+
+// toMeter is the length of the unit in meters
+func (unit Unit) toMeter() float64 {
+	switch unit {
+	case Feet:
+		return intFoot
+	case USSurveyFeet:
+		return usFoot
+	}
+	return 1
+}
+
+// validUnits checks the declared units against the srs, which must be projected for horizontal units
+func (o *Options) validUnits() error {
+	for _, unit := range []Unit{o.HorizontalUnits, o.VerticalUnits} {
+		if err := unit.valid(); err != nil {
+			return err
+		}
+	}
+
+	if o.HorizontalUnits == "" {
+		return nil
+	}
+
+	if o.MineGrid != nil {
+		return errors.New("horizontal units can't be declared for a mine grid, its control points relate its own units")
+	}
+
+	if o.srs == nil || o.srs.IsGeographic() {
+		return errors.New("horizontal units need a declared projected srs")
+	}
+
+	return nil
+}
+
+// fromUnits scales an inbound x y to the units of the declared srs
+func (o *Options) fromUnits(x float64, y float64) (float64, float64) {
+	if o.HorizontalUnits == "" || o.srs == nil {
+		return x, y
+	}
+
+	scale := o.HorizontalUnits.toMeter() / o.srs.toMeter()
+	return x * scale, y * scale
+}
+
+// metadata records how the dataset was read, for the Datasets
+func (o *Options) metadata() []Attribute {
+	var metadata []Attribute
+
+	if o.HorizontalUnits != "" {
+		metadata = append(metadata, Attribute{Key: "horizontalunits", Value: string(o.HorizontalUnits)})
+	}
+
+	if o.VerticalUnits != "" {
+		metadata = append(metadata, Attribute{Key: "verticalunits", Value: string(o.VerticalUnits)})
+	}
+
+	return metadata
+}
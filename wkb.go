@@ -0,0 +1,306 @@
+package convert
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// wkb geometry types, before their Z / M flags
+const (
+	wkbPoint              = 1
+	wkbLineString         = 2
+	wkbPolygon            = 3
+	wkbMultiPoint         = 4
+	wkbMultiLineString    = 5
+	wkbMultiPolygon       = 6
+	wkbGeometryCollection = 7
+)
+
+// errWKB is returned for well known binary that can't be read
+var errWKB = errors.New("unreadable wkb")
+
+// wkbReader ... reads a geometry of well known binary, in the byte order of each geometry
+type wkbReader struct {
+	b     []byte
+	order binary.ByteOrder
+	srid  int
+}
+
+// DecodeWKB reads well known binary, ISO or postgis extended (EWKB) with its Z / M flags and
+// SRID, as a geojson geometry, whose coordinates are the nested float slices ParseNestedGeom
+// takes.  Z is kept, M is dropped.  The SRID is 0 unless the EWKB embeds one.  An empty
+// geometry, a point of NaN ordinates or a geometry of no points, rings or members, is nil, and
+// empty members of a multi geometry or collection are dropped.
+func DecodeWKB(b []byte) (*geojson.Geometry, int, error) {
+	r := &wkbReader{b: b}
+
+	geometry, err := r.geometry(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(r.b) > 0 {
+		return nil, 0, fmt.Errorf("%v: %d bytes after the geometry", errWKB, len(r.b))
+	}
+	return geometry, r.srid, nil
+}
+
+func (r *wkbReader) uint32() (uint32, error) {
+	if len(r.b) < 4 {
+		return 0, fmt.Errorf("%v: truncated", errWKB)
+	}
+	v := r.order.Uint32(r.b)
+	r.b = r.b[4:]
+	return v, nil
+}
+
+func (r *wkbReader) float64() (float64, error) {
+	if len(r.b) < 8 {
+		return 0, fmt.Errorf("%v: truncated", errWKB)
+	}
+	v := math.Float64frombits(r.order.Uint64(r.b))
+	r.b = r.b[8:]
+	return v, nil
+}
+
+// count reads a count of elements at least size bytes each, refusing counts longer than the wkb
+func (r *wkbReader) count(size int) (int, error) {
+	n, err := r.uint32()
+	if err != nil {
+		return 0, err
+	}
+	if int(n) > len(r.b)/size {
+		return 0, fmt.Errorf("%v: %d elements in %d bytes", errWKB, n, len(r.b))
+	}
+	return int(n), nil
+}
+
+// header reads the byte order and type of a geometry, returning the base type and the dimensions
+func (r *wkbReader) header() (int, int, bool, error) {
+	if len(r.b) < 1 {
+		return 0, 0, false, fmt.Errorf("%v: truncated", errWKB)
+	}
+
+	switch r.b[0] {
+	case 0:
+		r.order = binary.BigEndian
+	case 1:
+		r.order = binary.LittleEndian
+	default:
+		return 0, 0, false, fmt.Errorf("%v: byte order %d", errWKB, r.b[0])
+	}
+	r.b = r.b[1:]
+
+	code, err := r.uint32()
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	// the postgis flags, then the iso thousands
+	hasZ := code&0x80000000 != 0
+	hasM := code&0x40000000 != 0
+	if code&0x20000000 != 0 {
+		// an embedded srid, that of the outermost geometry holds for its members
+		srid, err := r.uint32()
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if r.srid == 0 {
+			r.srid = int(srid)
+		}
+	}
+	code &= 0x0fffffff
+
+	switch code / 1000 {
+	case 1:
+		hasZ = true
+	case 2:
+		hasM = true
+	case 3:
+		hasZ, hasM = true, true
+	}
+
+	dims := 2
+	if hasZ {
+		dims++
+	}
+	if hasM {
+		dims++
+	}
+
+	return int(code % 1000), dims, hasZ, nil
+}
+
+// point reads a coordinate of dims ordinates, keeping x y and z
+func (r *wkbReader) point(dims int, hasZ bool) ([]float64, error) {
+	ordinates := make([]float64, dims)
+	for i := range ordinates {
+		v, err := r.float64()
+		if err != nil {
+			return nil, err
+		}
+		ordinates[i] = v
+	}
+
+	if hasZ {
+		return ordinates[:3], nil
+	}
+	return ordinates[:2], nil
+}
+
+// points reads a counted run of coordinates
+func (r *wkbReader) points(dims int, hasZ bool) ([][]float64, error) {
+	n, err := r.count(dims * 8)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([][]float64, n)
+	for i := range points {
+		if points[i], err = r.point(dims, hasZ); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+// rings reads a counted run of rings, a polygon
+func (r *wkbReader) rings(dims int, hasZ bool) ([][][]float64, error) {
+	n, err := r.count(4)
+	if err != nil {
+		return nil, err
+	}
+
+	rings := make([][][]float64, n)
+	for i := range rings {
+		if rings[i], err = r.points(dims, hasZ); err != nil {
+			return nil, err
+		}
+	}
+	return rings, nil
+}
+
+// geometry reads a geometry, and the members of a multi geometry or collection
+func (r *wkbReader) geometry(depth int) (*geojson.Geometry, error) {
+	if depth > 32 {
+		return nil, fmt.Errorf("%v: nested too deeply", errWKB)
+	}
+
+	kind, dims, hasZ, err := r.header()
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case wkbPoint:
+		point, err := r.point(dims, hasZ)
+		if err != nil {
+			return nil, err
+		}
+
+		// an empty point is NaN NaN, wkb has no other way to say it
+		if math.IsNaN(point[0]) && math.IsNaN(point[1]) {
+			return nil, nil
+		}
+		return geojson.NewPointGeometry(point), nil
+
+	case wkbLineString:
+		line, err := r.points(dims, hasZ)
+		if err != nil || len(line) == 0 {
+			return nil, err
+		}
+		return geojson.NewLineStringGeometry(line), nil
+
+	case wkbPolygon:
+		polygon, err := r.rings(dims, hasZ)
+		if err != nil || len(polygon) == 0 || len(polygon[0]) == 0 {
+			return nil, err
+		}
+		return geojson.NewPolygonGeometry(polygon), nil
+	}
+
+	if kind < wkbMultiPoint || kind > wkbGeometryCollection {
+		return nil, fmt.Errorf("%v: unsupported geometry type %d", errWKB, kind)
+	}
+
+	// the members of multi geometries carry their own headers
+	n, err := r.count(5)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []*geojson.Geometry
+	for i := 0; i < n; i++ {
+		member, err := r.geometry(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if member != nil {
+			members = append(members, member)
+		}
+	}
+
+	// a multi geometry or collection of no members, or only empty ones, is empty
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	switch kind {
+	case wkbMultiPoint:
+		var points [][]float64
+		for _, member := range members {
+			if member.Type != geojson.GeometryPoint {
+				return nil, fmt.Errorf("%v: %s in a multipoint", errWKB, member.Type)
+			}
+			points = append(points, member.Point)
+		}
+		return geojson.NewMultiPointGeometry(points...), nil
+
+	case wkbMultiLineString:
+		var lines [][][]float64
+		for _, member := range members {
+			if member.Type != geojson.GeometryLineString {
+				return nil, fmt.Errorf("%v: %s in a multilinestring", errWKB, member.Type)
+			}
+			lines = append(lines, member.LineString)
+		}
+		return geojson.NewMultiLineStringGeometry(lines...), nil
+
+	case wkbMultiPolygon:
+		var polygons [][][][]float64
+		for _, member := range members {
+			if member.Type != geojson.GeometryPolygon {
+				return nil, fmt.Errorf("%v: %s in a multipolygon", errWKB, member.Type)
+			}
+			polygons = append(polygons, member.Polygon)
+		}
+		return geojson.NewMultiPolygonGeometry(polygons...), nil
+	}
+
+	return geojson.NewCollectionGeometry(members...), nil
+}
+
+// splitGeometry breaks the geometries ParseGEOJSONFeature can't take into ones it can,
+// a multipoint into points and a collection into its members
+func splitGeometry(geometry *geojson.Geometry) []*geojson.Geometry {
+	switch geometry.Type {
+	case geojson.GeometryMultiPoint:
+		var points []*geojson.Geometry
+		for _, point := range geometry.MultiPoint {
+			points = append(points, geojson.NewPointGeometry(point))
+		}
+		return points
+
+	case geojson.GeometryCollection:
+		var members []*geojson.Geometry
+		for _, member := range geometry.Geometries {
+			members = append(members, splitGeometry(member)...)
+		}
+		return members
+	}
+
+	return []*geojson.Geometry{geometry}
+}
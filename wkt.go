@@ -0,0 +1,327 @@
+package convert
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// errWKT is returned for well known text that can't be read
+var errWKT = errors.New("unreadable wkt")
+
+// wktTypes are the geometry keywords of well known text, by their wkb types
+var wktTypes = map[string]int{
+	"POINT":              wkbPoint,
+	"LINESTRING":         wkbLineString,
+	"POLYGON":            wkbPolygon,
+	"MULTIPOINT":         wkbMultiPoint,
+	"MULTILINESTRING":    wkbMultiLineString,
+	"MULTIPOLYGON":       wkbMultiPolygon,
+	"GEOMETRYCOLLECTION": wkbGeometryCollection,
+}
+
+// wktReader ... reads a geometry of well known text, a token at a time
+type wktReader struct {
+	s string
+}
+
+// DecodeGeometry reads a geometry as it's dumped from a database, hex (E)WKB, eg
+// 0101000020E6100000..., or (E)WKT, eg SRID=4326;POINT Z (1 2 3).  See DecodeWKB.
+func DecodeGeometry(s string) (*geojson.Geometry, int, error) {
+	s = strings.TrimSpace(s)
+
+	// postgres prints bytea as \x...
+	hexed := strings.TrimPrefix(s, `\x`)
+	if len(hexed) >= 10 && (strings.HasPrefix(hexed, "00") || strings.HasPrefix(hexed, "01")) {
+		if b, err := hex.DecodeString(hexed); err == nil {
+			return DecodeWKB(b)
+		}
+	}
+
+	return DecodeWKT(s)
+}
+
+// DecodeWKT reads well known text, ISO or with a postgis SRID=...; prefix (EWKT), as a geojson
+// geometry, whose coordinates are the nested float slices ParseNestedGeom takes.  Z is kept,
+// M is dropped.  An EMPTY geometry is nil, the SRID is 0 unless the EWKT has one.
+func DecodeWKT(wkt string) (*geojson.Geometry, int, error) {
+	wkt = strings.TrimSpace(wkt)
+
+	srid := 0
+	if strings.HasPrefix(strings.ToUpper(wkt), "SRID=") {
+		end := strings.IndexByte(wkt, ';')
+		if end < 0 {
+			return nil, 0, fmt.Errorf("%v: SRID without a geometry", errWKT)
+		}
+
+		var err error
+		if srid, err = strconv.Atoi(strings.TrimSpace(wkt[5:end])); err != nil {
+			return nil, 0, fmt.Errorf("%v: SRID %s", errWKT, wkt[5:end])
+		}
+		wkt = wkt[end+1:]
+	}
+
+	r := &wktReader{s: wkt}
+	geometry, err := r.geometry(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if rest := strings.TrimSpace(r.s); rest != "" {
+		return nil, 0, fmt.Errorf("%v: unexpected %q after the geometry", errWKT, rest)
+	}
+	return geometry, srid, nil
+}
+
+// token reads the next word, number or punctuation
+func (r *wktReader) token() string {
+	r.s = strings.TrimLeft(r.s, " \t\r\n")
+	if r.s == "" {
+		return ""
+	}
+
+	if strings.IndexByte("(),", r.s[0]) >= 0 {
+		token := r.s[:1]
+		r.s = r.s[1:]
+		return token
+	}
+
+	end := strings.IndexAny(r.s, " \t\r\n(),")
+	if end < 0 {
+		end = len(r.s)
+	}
+	token := r.s[:end]
+	r.s = r.s[end:]
+	return token
+}
+
+// peek is the next token, without reading it
+func (r *wktReader) peek() string {
+	s := r.s
+	token := r.token()
+	r.s = s
+	return token
+}
+
+// expect reads a token that must be the one given
+func (r *wktReader) expect(want string) error {
+	if token := r.token(); token != want {
+		return fmt.Errorf("%v: expected %q, found %q", errWKT, want, token)
+	}
+	return nil
+}
+
+// header reads a geometry keyword and its dimensions, eg POINT Z, POINTZM or LINESTRING M.
+// empty is true for an EMPTY geometry.
+func (r *wktReader) header() (int, bool, bool, bool, error) {
+	keyword := strings.ToUpper(r.token())
+
+	hasZ, hasM := false, false
+	kind, ok := wktTypes[keyword]
+	for _, suffix := range []string{"ZM", "Z", "M"} {
+		if ok {
+			break
+		}
+		if kind, ok = wktTypes[strings.TrimSuffix(keyword, suffix)]; ok {
+			hasZ, hasM = strings.Contains(suffix, "Z"), strings.Contains(suffix, "M")
+		}
+	}
+	if !ok {
+		return 0, false, false, false, fmt.Errorf("%v: unsupported geometry %q", errWKT, keyword)
+	}
+
+	switch strings.ToUpper(r.peek()) {
+	case "ZM":
+		hasZ, hasM = true, true
+		r.token()
+	case "Z":
+		hasZ = true
+		r.token()
+	case "M":
+		hasM = true
+		r.token()
+	}
+
+	if strings.ToUpper(r.peek()) == "EMPTY" {
+		r.token()
+		return kind, hasZ, hasM, true, nil
+	}
+
+	return kind, hasZ, hasM, false, nil
+}
+
+// point reads the ordinates of a coordinate, keeping x y and z.  Without a Z / M tag, a third
+// ordinate is Z and a fourth M.
+func (r *wktReader) point(hasZ bool, hasM bool) ([]float64, error) {
+	var ordinates []float64
+	for {
+		token := r.peek()
+		if token == "" || token == "," || token == ")" {
+			break
+		}
+
+		v, err := strconv.ParseFloat(r.token(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v: coordinate %q", errWKT, token)
+		}
+		ordinates = append(ordinates, v)
+	}
+
+	if len(ordinates) < 2 || len(ordinates) > 4 {
+		return nil, fmt.Errorf("%v: a coordinate of %d ordinates", errWKT, len(ordinates))
+	}
+
+	// an xym coordinate's third ordinate is M
+	if hasM && !hasZ && len(ordinates) == 3 {
+		return ordinates[:2], nil
+	}
+	if len(ordinates) > 3 {
+		return ordinates[:3], nil
+	}
+	return ordinates, nil
+}
+
+// list reads a parenthesized, comma separated run of items
+func (r *wktReader) list(item func() error) error {
+	if err := r.expect("("); err != nil {
+		return err
+	}
+
+	for {
+		if err := item(); err != nil {
+			return err
+		}
+
+		switch token := r.token(); token {
+		case ",":
+		case ")":
+			return nil
+		default:
+			return fmt.Errorf("%v: expected \",\" or \")\", found %q", errWKT, token)
+		}
+	}
+}
+
+// points reads a parenthesized run of coordinates, a linestring or ring
+func (r *wktReader) points(hasZ bool, hasM bool) ([][]float64, error) {
+	var points [][]float64
+	err := r.list(func() error {
+		point, err := r.point(hasZ, hasM)
+		points = append(points, point)
+		return err
+	})
+	return points, err
+}
+
+// rings reads a parenthesized run of rings, a polygon
+func (r *wktReader) rings(hasZ bool, hasM bool) ([][][]float64, error) {
+	var rings [][][]float64
+	err := r.list(func() error {
+		ring, err := r.points(hasZ, hasM)
+		rings = append(rings, ring)
+		return err
+	})
+	return rings, err
+}
+
+// geometry reads a geometry, and the members of a multi geometry or collection
+func (r *wktReader) geometry(depth int) (*geojson.Geometry, error) {
+	if depth > 32 {
+		return nil, fmt.Errorf("%v: nested too deeply", errWKT)
+	}
+
+	kind, hasZ, hasM, empty, err := r.header()
+	if err != nil || empty {
+		return nil, err
+	}
+
+	switch kind {
+	case wkbPoint:
+		var point []float64
+		err := r.list(func() error {
+			var err error
+			point, err = r.point(hasZ, hasM)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return geojson.NewPointGeometry(point), nil
+
+	case wkbLineString:
+		line, err := r.points(hasZ, hasM)
+		if err != nil {
+			return nil, err
+		}
+		return geojson.NewLineStringGeometry(line), nil
+
+	case wkbPolygon:
+		polygon, err := r.rings(hasZ, hasM)
+		if err != nil {
+			return nil, err
+		}
+		return geojson.NewPolygonGeometry(polygon), nil
+
+	case wkbMultiPoint:
+		// the points may or may not be parenthesized, MULTIPOINT (1 2, 3 4) or ((1 2), (3 4))
+		var points [][]float64
+		err := r.list(func() error {
+			var point []float64
+			var err error
+			if r.peek() == "(" {
+				var inner [][]float64
+				inner, err = r.points(hasZ, hasM)
+				if err == nil && len(inner) != 1 {
+					err = fmt.Errorf("%v: a multipoint member of %d points", errWKT, len(inner))
+				}
+				if err == nil {
+					point = inner[0]
+				}
+			} else {
+				point, err = r.point(hasZ, hasM)
+			}
+			points = append(points, point)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return geojson.NewMultiPointGeometry(points...), nil
+
+	case wkbMultiLineString:
+		lines, err := r.rings(hasZ, hasM)
+		if err != nil {
+			return nil, err
+		}
+		return geojson.NewMultiLineStringGeometry(lines...), nil
+
+	case wkbMultiPolygon:
+		var polygons [][][][]float64
+		err := r.list(func() error {
+			polygon, err := r.rings(hasZ, hasM)
+			polygons = append(polygons, polygon)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return geojson.NewMultiPolygonGeometry(polygons...), nil
+	}
+
+	// a collection's members carry their own keywords, empty members are dropped
+	var members []*geojson.Geometry
+	err = r.list(func() error {
+		member, err := r.geometry(depth + 1)
+		if member != nil {
+			members = append(members, member)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return geojson.NewCollectionGeometry(members...), nil
+}
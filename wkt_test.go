@@ -0,0 +1,143 @@
+package convert
+
+import (
+	"os"
+	"testing"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+const (
+	//wkt testing dataset
+	wktcsv = "tests/wkt/features.csv"
+)
+
+func TestDecodeGeometry(t *testing.T) {
+
+	tests := []struct {
+		geometry string
+		kind     geojson.GeometryType
+		srid     int
+		count    int
+	}{
+		{"POINT (1 2)", geojson.GeometryPoint, 0, 2},
+		{"point z (1 2 3)", geojson.GeometryPoint, 0, 3},
+		{"POINTM (1 2 9)", geojson.GeometryPoint, 0, 2},
+		{"POINT ZM (1 2 3 9)", geojson.GeometryPoint, 0, 3},
+		{"SRID=4326;LINESTRING (1 2, 3 4, 5 6)", geojson.GeometryLineString, 4326, 3},
+		{"POLYGON ((0 0, 1 0, 1 1, 0 0), (0.2 0.2, 0.4 0.2, 0.4 0.4, 0.2 0.2))", geojson.GeometryPolygon, 0, 2},
+		{"MULTIPOINT (1 2, 3 4)", geojson.GeometryMultiPoint, 0, 2},
+		{"MULTIPOINT ((1 2), (3 4), (5 6))", geojson.GeometryMultiPoint, 0, 3},
+		{"MULTIPOLYGON (((0 0, 1 0, 1 1, 0 0)), ((5 5, 6 5, 6 6, 5 5)))", geojson.GeometryMultiPolygon, 0, 2},
+		{"GEOMETRYCOLLECTION (POINT (1 2), POINT EMPTY, LINESTRING (1 2, 3 4))", geojson.GeometryCollection, 0, 2},
+		// a hex EWKB point z with srid 4326, as postgis prints it
+		{"01010000A0E6100000000000000000F03F00000000000000400000000000000840", geojson.GeometryPoint, 4326, 3},
+		{`\x0101000000000000000000F03F0000000000000040`, geojson.GeometryPoint, 0, 2},
+	}
+
+	for _, test := range tests {
+		geometry, srid, err := DecodeGeometry(test.geometry)
+		if err != nil {
+			t.Errorf("%s encountered %v\n", test.geometry, err)
+			continue
+		}
+
+		count := 0
+		switch geometry.Type {
+		case geojson.GeometryPoint:
+			count = len(geometry.Point)
+		case geojson.GeometryLineString:
+			count = len(geometry.LineString)
+		case geojson.GeometryPolygon:
+			count = len(geometry.Polygon)
+		case geojson.GeometryMultiPoint:
+			count = len(geometry.MultiPoint)
+		case geojson.GeometryMultiPolygon:
+			count = len(geometry.MultiPolygon)
+		case geojson.GeometryCollection:
+			count = len(geometry.Geometries)
+		}
+
+		if geometry.Type != test.kind || srid != test.srid || count != test.count {
+			t.Errorf("%s was a %s of %d with srid %d, expected a %s of %d with srid %d\n", test.geometry, geometry.Type, count, srid, test.kind, test.count, test.srid)
+		}
+	}
+
+	// empty geometries are nil, as postgis prints them in wkb too
+	empties := []string{
+		"LINESTRING EMPTY",
+		"010200000000000000",
+		"010300000000000000",
+		"010600000000000000",
+		"0101000000000000000000F87F000000000000F87F",
+		// a collection of only an empty polygon
+		"0107000000010000000103000000" + "00000000",
+	}
+	for _, empty := range empties {
+		if geometry, _, err := DecodeGeometry(empty); geometry != nil || err != nil {
+			t.Errorf("empty geometry %s was %v, %v expected nil\n", empty, geometry, err)
+		}
+	}
+
+	// an empty member of a multi geometry is dropped
+	geometry, _, err := DecodeGeometry("0104000000020000000101000000000000000000F87F000000000000F87F0101000000000000000000F03F0000000000000040")
+	if err != nil || geometry == nil || len(geometry.MultiPoint) != 1 {
+		t.Errorf("a multipoint of an empty and a real point was %v, %v expected one point\n", geometry, err)
+	}
+
+	for _, bad := range []string{"POINT (1)", "LINESTRING (1 2, 3 4", "CIRCLE (1 2 3)", "POINT (1 2) POINT (3 4)", "0101000000000000000000F03F"} {
+		if _, _, err := DecodeGeometry(bad); err == nil {
+			t.Errorf("%s should be refused\n", bad)
+		}
+	}
+}
+
+func TestCSVGeometry(t *testing.T) {
+
+	data, err := os.Open(wktcsv)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer data.Close()
+
+	// no srs declared, the srid of the geometries has it
+	results, err := DatasetFromCSV("", "", "", data, Options{GeometryField: "geom", Elevation: ConstantProvider{Z: 1234}})
+	if err != nil {
+		t.Errorf("csv geometry conversion error for %s: %v\n", wktcsv, err)
+		return
+	}
+
+	// the empty point is skipped, the multipoint is two points
+	if len(results.Points) != 3 || len(results.Lines) != 1 || len(results.Shapes) != 1 {
+		t.Errorf("%s had %d points, %d lines and %d shapes, expected 3, 1 and 1\n", wktcsv, len(results.Points), len(results.Lines), len(results.Shapes))
+		return
+	}
+
+	utm := Options{SRS: 32612}
+	expected, _ := utm.checkCoords([]float64{392500, 3770000, 1510.5})
+	point := results.Points[0]
+	if point.Name != "S-001" || point.Points[0] != expected[0] || point.Points[1] != expected[1] || point.Points[2] != expected[2] {
+		t.Errorf("ewkb sample %q was %v, expected S-001 at %v\n", point.Name, point.Points, expected)
+	}
+
+	want := []Attribute{{Key: "type", Value: "sample"}, {Key: "grade", Value: "1.25"}}
+	if len(point.Attributes) != len(want) || point.Attributes[0] != want[0] || point.Attributes[1] != want[1] {
+		t.Errorf("ewkb sample attributes were %v, expected %v\n", point.Attributes, want)
+	}
+
+	// a line without z is filled from the dem
+	if road := results.Lines[0]; road.Name != "Haul road" || road.Points[0][2] != 1234 {
+		t.Errorf("road %q was %v, expected the dem's 1234\n", road.Name, road.Points[0])
+	}
+
+	if claim := results.Shapes[0]; len(claim.Points) != 1 || len(claim.Points[0]) != 2 {
+		t.Errorf("claim with a hole was %v\n", claim.Points)
+	}
+
+	// the srid must agree with the declared srs
+	data.Seek(0, 0)
+	if _, err := DatasetFromCSV("", "", "", data, Options{SRS: 4326, GeometryField: "geom", Elevation: ConstantProvider{}}); err == nil {
+		t.Errorf("a geometry srid conflicting with the declared srs should be refused\n")
+	}
+}